@@ -0,0 +1,333 @@
+package n26keychain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bool64/ctxd"
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+)
+
+// Audited operations.
+const (
+	AuditOperationGet      = "get"
+	AuditOperationSet      = "set"
+	AuditOperationDelete   = "delete"
+	AuditOperationList     = "list"
+	AuditOperationHistory  = "history"
+	AuditOperationRollback = "rollback"
+)
+
+// Outcomes of the audited operations.
+const (
+	AuditOutcomeSuccess  = "success"
+	AuditOutcomeNotFound = "not_found"
+	AuditOutcomeFailure  = "failure"
+)
+
+var (
+	_ Storage        = (*auditStorage)(nil)
+	_ StorageContext = (*auditStorage)(nil)
+	_ Lister         = (*auditStorage)(nil)
+	_ Notifier       = (*auditStorage)(nil)
+	_ Versioned      = (*auditStorage)(nil)
+	_ HistoryKeeper  = (*auditStorage)(nil)
+
+	_ AuditSink = (*JSONLinesAuditSink)(nil)
+	_ AuditSink = (*loggerAuditSink)(nil)
+)
+
+type callerCtxKey struct{}
+
+// AuditEvent is a record of an access to the storage. It never contains the secret.
+type AuditEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	Service   string    `json:"service"`
+	Key       string    `json:"key,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Caller    string    `json:"caller,omitempty"`
+}
+
+// AuditSink records the audit events.
+type AuditSink interface {
+	Audit(ctx context.Context, e AuditEvent) error
+}
+
+// AuditSinkFunc is an inline AuditSink.
+type AuditSinkFunc func(ctx context.Context, e AuditEvent) error
+
+// Audit satisfies AuditSink.
+func (f AuditSinkFunc) Audit(ctx context.Context, e AuditEvent) error {
+	return f(ctx, e)
+}
+
+// AuditStorageOption configures the audit storage.
+type AuditStorageOption func(s *auditStorage)
+
+type auditStorage struct {
+	storage StorageContext
+	sink    AuditSink
+	clock   clock.Clock
+	service string
+
+	strict bool
+}
+
+// Set sets password in the underlying storage and records the access.
+func (s *auditStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage and records the access.
+func (s *auditStorage) SetContext(ctx context.Context, user, password string) error {
+	err := s.storage.SetContext(ctx, user, password)
+
+	return s.audit(ctx, AuditOperationSet, user, err)
+}
+
+// Get gets password from the underlying storage and records the access.
+func (s *auditStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage and records the access.
+func (s *auditStorage) GetContext(ctx context.Context, user string) (string, error) {
+	password, err := s.storage.GetContext(ctx, user)
+
+	if err := s.audit(ctx, AuditOperationGet, user, err); err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// Delete deletes secret from the underlying storage and records the access.
+func (s *auditStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage and records the access.
+func (s *auditStorage) DeleteContext(ctx context.Context, user string) error {
+	err := s.storage.DeleteContext(ctx, user)
+
+	return s.audit(ctx, AuditOperationDelete, user, err)
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing, and records the access.
+func (s *auditStorage) Keys() ([]string, error) {
+	keys, err := listKeys(s.storage)
+
+	if err := s.audit(context.Background(), AuditOperationList, "", err); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *auditStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions, and records the access as a
+// get.
+func (s *auditStorage) GetVersion(user string) (string, string, error) {
+	password, version, err := GetVersion(FromStorageContext(s.storage), user)
+
+	if err := s.audit(context.Background(), AuditOperationGet, user, err); err != nil {
+		return "", "", err
+	}
+
+	return password, version, nil
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions, and records the access as a set.
+func (s *auditStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	version, err := SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+
+	return version, s.audit(context.Background(), AuditOperationSet, user, err)
+}
+
+// History returns the versions of the key, if the underlying storage keeps them, and records the access.
+func (s *auditStorage) History(user string) ([]HistoryEntry, error) {
+	entries, err := History(FromStorageContext(s.storage), user)
+
+	if err := s.audit(context.Background(), AuditOperationHistory, user, err); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history, and records
+// the access.
+func (s *auditStorage) Rollback(user string, version int) error {
+	err := Rollback(FromStorageContext(s.storage), user, version)
+
+	return s.audit(context.Background(), AuditOperationRollback, user, err)
+}
+
+// audit records the access and returns the error of the operation. In strict mode, the operation fails if it can not
+// be recorded.
+func (s *auditStorage) audit(ctx context.Context, operation, key string, err error) error {
+	e := AuditEvent{
+		Timestamp: s.clock.Now(),
+		Operation: operation,
+		Service:   s.service,
+		Key:       key,
+		Outcome:   AuditOutcomeSuccess,
+		Caller:    CallerFromContext(ctx),
+	}
+
+	switch {
+	case errors.Is(err, keyring.ErrNotFound):
+		e.Outcome = AuditOutcomeNotFound
+
+	case err != nil:
+		e.Outcome = AuditOutcomeFailure
+		e.Error = err.Error()
+	}
+
+	if auditErr := s.sink.Audit(ctx, e); auditErr != nil && s.strict && err == nil {
+		return fmt.Errorf("could not record audit event: %w", auditErr)
+	}
+
+	return err
+}
+
+// NewAuditStorage creates a storage that records every access to the underlying storage in the sink: the operation,
+// the service, the key, the outcome and the caller, see ContextWithCaller. The secrets are never recorded. The errors
+// of the sink are ignored, unless WithStrictAudit is used.
+func NewAuditStorage(storage Storage, service string, sink AuditSink, options ...AuditStorageOption) Storage {
+	s := &auditStorage{
+		storage: ToStorageContext(storage),
+		sink:    sink,
+		clock:   clock.New(),
+		service: service,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithAuditClock sets the clock of the audit storage.
+func WithAuditClock(c clock.Clock) AuditStorageOption {
+	return func(s *auditStorage) {
+		s.clock = c
+	}
+}
+
+// WithStrictAudit makes the operations fail when their access can not be recorded. A value that is set or deleted is
+// still changed in the underlying storage.
+func WithStrictAudit() AuditStorageOption {
+	return func(s *auditStorage) {
+		s.strict = true
+	}
+}
+
+// ContextWithCaller returns a context that identifies the caller in the audit events, for example the name of the
+// command or the user that runs it.
+func ContextWithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerCtxKey{}, caller)
+}
+
+// CallerFromContext returns the caller in the context, or an empty string if there is none.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerCtxKey{}).(string) //nolint: errcheck
+
+	return caller
+}
+
+// JSONLinesAuditSink writes the audit events as JSON lines.
+type JSONLinesAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// Audit writes the event as a JSON line.
+func (s *JSONLinesAuditSink) Audit(_ context.Context, e AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(data, '\n'))
+
+	return err
+}
+
+// Close closes the file of the sink, if it was opened by OpenJSONLinesAuditSink.
+func (s *JSONLinesAuditSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
+
+// NewJSONLinesAuditSink creates a sink that writes the audit events as JSON lines to the writer.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// OpenJSONLinesAuditSink creates a sink that appends the audit events as JSON lines to the file, which is created if it
+// does not exist. The sink must be closed.
+func OpenJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), fileDirMode); err != nil {
+		return nil, fmt.Errorf("could not create audit directory: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_APPEND|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit file: %w", err)
+	}
+
+	return &JSONLinesAuditSink{w: f, closer: f}, nil
+}
+
+type loggerAuditSink struct {
+	logger ctxd.Logger
+}
+
+// Audit logs the event.
+func (s *loggerAuditSink) Audit(ctx context.Context, e AuditEvent) error {
+	keysAndValues := []interface{}{
+		"timestamp", e.Timestamp,
+		"operation", e.Operation,
+		"service", e.Service,
+		"key", e.Key,
+		"outcome", e.Outcome,
+		"caller", e.Caller,
+	}
+
+	if e.Error != "" {
+		keysAndValues = append(keysAndValues, "error", e.Error)
+	}
+
+	s.logger.Important(ctx, "keychain access", keysAndValues...)
+
+	return nil
+}
+
+// NewLoggerAuditSink creates a sink that logs the audit events as important messages, so they are logged at any level.
+func NewLoggerAuditSink(logger ctxd.Logger) AuditSink {
+	return &loggerAuditSink{logger: logger}
+}
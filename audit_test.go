@@ -0,0 +1,217 @@
+package n26keychain_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bool64/ctxd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestAuditStorage(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := new(bytes.Buffer)
+
+	s := n26keychain.ToStorageContext(n26keychain.NewAuditStorage(
+		n26keychain.NewMemoryStorage(), "n26api.credentials",
+		n26keychain.NewJSONLinesAuditSink(buf),
+		n26keychain.WithAuditClock(clock.Fix(ts)),
+	))
+
+	ctx := n26keychain.ContextWithCaller(context.Background(), "cli")
+
+	require.NoError(t, s.SetContext(ctx, "foo", "secret"))
+
+	data, err := s.GetContext(ctx, "foo")
+
+	assert.Equal(t, "secret", data)
+	assert.NoError(t, err)
+
+	keys, err := n26keychain.Keys(n26keychain.FromStorageContext(s))
+
+	assert.Equal(t, []string{"foo"}, keys)
+	assert.NoError(t, err)
+
+	require.NoError(t, s.DeleteContext(ctx, "foo"))
+
+	_, err = s.GetContext(ctx, "foo")
+
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+
+	expected := `{"timestamp":"2020-01-02T03:04:05Z","operation":"set","service":"n26api.credentials","key":"foo","outcome":"success","caller":"cli"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"get","service":"n26api.credentials","key":"foo","outcome":"success","caller":"cli"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"list","service":"n26api.credentials","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"delete","service":"n26api.credentials","key":"foo","outcome":"success","caller":"cli"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"get","service":"n26api.credentials","key":"foo","outcome":"not_found","caller":"cli"}
+`
+
+	assert.Equal(t, expected, buf.String())
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestAuditStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := new(bytes.Buffer)
+
+	s := n26keychain.NewAuditStorage(
+		n26keychain.NewVersionedStorage(n26keychain.NewMemoryStorage()), "n26api.token",
+		n26keychain.NewJSONLinesAuditSink(buf),
+		n26keychain.WithAuditClock(clock.Fix(ts)),
+	)
+
+	version, err := n26keychain.SetIfMatch(s, "foo", "", "secret")
+	require.NoError(t, err)
+
+	data, current, err := n26keychain.GetVersion(s, "foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "secret", data)
+	assert.Equal(t, version, current)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", "", "secret")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	expected := `{"timestamp":"2020-01-02T03:04:05Z","operation":"set","service":"n26api.token","key":"foo","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"get","service":"n26api.token","key":"foo","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"set","service":"n26api.token","key":"foo","outcome":"failure","error":"entry was changed concurrently: \"foo\""}
+`
+
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestAuditStorage_History(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := new(bytes.Buffer)
+
+	s := n26keychain.NewAuditStorage(
+		n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0), "n26api.credentials",
+		n26keychain.NewJSONLinesAuditSink(buf),
+		n26keychain.WithAuditClock(clock.Fix(ts)),
+	)
+
+	require.NoError(t, s.Set("foo", "first"))
+	require.NoError(t, s.Set("foo", "second"))
+
+	history, err := n26keychain.History(s, "foo")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	require.NoError(t, n26keychain.Rollback(s, "foo", history[0].Version))
+
+	err = n26keychain.Rollback(s, "foo", 42)
+	require.ErrorIs(t, err, n26keychain.ErrHistoryVersionNotFound)
+
+	expected := `{"timestamp":"2020-01-02T03:04:05Z","operation":"set","service":"n26api.credentials","key":"foo","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"set","service":"n26api.credentials","key":"foo","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"history","service":"n26api.credentials","key":"foo","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"rollback","service":"n26api.credentials","key":"foo","outcome":"success"}
+{"timestamp":"2020-01-02T03:04:05Z","operation":"rollback","service":"n26api.credentials","key":"foo","outcome":"failure","error":"version not found in history: \"foo\" version 42"}
+`
+
+	assert.Equal(t, expected, buf.String())
+	assert.NotContains(t, buf.String(), "first")
+}
+
+func TestAuditStorage_Failure(t *testing.T) {
+	t.Parallel()
+
+	var events []n26keychain.AuditEvent
+
+	s := n26keychain.NewAuditStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "secret").Return(errors.New("set error"))
+	})(t), "service", n26keychain.AuditSinkFunc(func(_ context.Context, e n26keychain.AuditEvent) error {
+		events = append(events, e)
+
+		return nil
+	}))
+
+	err := s.Set("foo", "secret")
+
+	assert.EqualError(t, err, "set error")
+	require.Len(t, events, 1)
+	assert.Equal(t, n26keychain.AuditOutcomeFailure, events[0].Outcome)
+	assert.Equal(t, "set error", events[0].Error)
+}
+
+func TestAuditStorage_SinkError(t *testing.T) {
+	t.Parallel()
+
+	sink := n26keychain.AuditSinkFunc(func(context.Context, n26keychain.AuditEvent) error {
+		return errors.New("sink error")
+	})
+
+	memory := n26keychain.NewMemoryStorage()
+
+	require.NoError(t, memory.Set("foo", "secret"))
+
+	// The errors of the sink are ignored.
+	data, err := n26keychain.NewAuditStorage(memory, "service", sink).Get("foo")
+
+	assert.Equal(t, "secret", data)
+	assert.NoError(t, err)
+
+	// Unless the audit is strict.
+	data, err = n26keychain.NewAuditStorage(memory, "service", sink, n26keychain.WithStrictAudit()).Get("foo")
+
+	assert.Empty(t, data)
+	assert.EqualError(t, err, "could not record audit event: sink error")
+}
+
+func TestOpenJSONLinesAuditSink(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit", "keychain.log")
+
+	for i := 0; i < 2; i++ {
+		sink, err := n26keychain.OpenJSONLinesAuditSink(path)
+		require.NoError(t, err)
+
+		s := n26keychain.NewAuditStorage(n26keychain.NewMemoryStorage(), "service", sink)
+
+		_, _ = s.Get("foo") //nolint: errcheck
+
+		require.NoError(t, sink.Close())
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestLoggerAuditSink(t *testing.T) {
+	t.Parallel()
+
+	l := &ctxd.LoggerMock{}
+	s := n26keychain.NewAuditStorage(n26keychain.NewMemoryStorage(), "service", n26keychain.NewLoggerAuditSink(l),
+		n26keychain.WithAuditClock(clock.Fix(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))),
+	)
+
+	_, _ = s.Get("foo") //nolint: errcheck
+
+	expected := `important: keychain access {"caller":"","key":"foo","operation":"get","outcome":"not_found","service":"service","timestamp":"2020-01-02T03:04:05Z"}` + "\n"
+
+	assert.Equal(t, expected, l.String())
+}
@@ -0,0 +1,408 @@
+package n26keychain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+)
+
+const (
+	// DefaultCircuitFailureThreshold is the number of consecutive failures that opens the circuit.
+	DefaultCircuitFailureThreshold = 5
+	// DefaultCircuitOpenTimeout is how long the circuit stays open before an operation probes the storage again.
+	DefaultCircuitOpenTimeout = 30 * time.Second
+)
+
+// Circuit states.
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// ErrCircuitOpen indicates that the operation was not tried because the storage failed repeatedly.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var (
+	_ Storage        = (*circuitBreakerStorage)(nil)
+	_ StorageContext = (*circuitBreakerStorage)(nil)
+	_ CircuitBreaker = (*circuitBreakerStorage)(nil)
+	_ Lister         = (*circuitBreakerStorage)(nil)
+	_ Notifier       = (*circuitBreakerStorage)(nil)
+	_ Versioned      = (*circuitBreakerStorage)(nil)
+	_ HistoryKeeper  = (*circuitBreakerStorage)(nil)
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+
+	case CircuitOpen:
+		return "open"
+
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker is a storage that stops calling its underlying storage after repeated failures.
+type CircuitBreaker interface {
+	// State returns the state of the circuit.
+	State() CircuitState
+}
+
+// CircuitBreakerOption configures the circuit breaker storage.
+type CircuitBreakerOption func(s *circuitBreakerStorage)
+
+type circuitBreakerStorage struct {
+	storage StorageContext
+	clock   clock.Clock
+
+	threshold   int
+	openTimeout time.Duration
+	callTimeout time.Duration
+	isFailure   func(err error) bool
+	stateHook   func(from, to CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Set sets password in the underlying storage, unless the circuit is open.
+func (s *circuitBreakerStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage, unless the circuit is open.
+func (s *circuitBreakerStorage) SetContext(ctx context.Context, user, password string) error {
+	return s.call(func() error {
+		return s.storage.SetContext(ctx, user, password)
+	})
+}
+
+// Get gets password from the underlying storage, unless the circuit is open.
+func (s *circuitBreakerStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage, unless the circuit is open.
+func (s *circuitBreakerStorage) GetContext(ctx context.Context, user string) (string, error) {
+	var password string
+
+	err := s.call(func() error {
+		var err error
+
+		password, err = s.storage.GetContext(ctx, user)
+
+		return err
+	})
+
+	return password, err
+}
+
+// Delete deletes secret from the underlying storage, unless the circuit is open.
+func (s *circuitBreakerStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage, unless the circuit is open.
+func (s *circuitBreakerStorage) DeleteContext(ctx context.Context, user string) error {
+	return s.call(func() error {
+		return s.storage.DeleteContext(ctx, user)
+	})
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing, unless the circuit is open.
+func (s *circuitBreakerStorage) Keys() ([]string, error) {
+	var keys []string
+
+	err := s.call(func() error {
+		var err error
+
+		keys, err = listKeys(s.storage)
+
+		return err
+	})
+
+	return keys, err
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *circuitBreakerStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions, unless the circuit is open.
+func (s *circuitBreakerStorage) GetVersion(user string) (string, string, error) {
+	var password, version string
+
+	err := s.call(func() error {
+		var err error
+
+		password, version, err = GetVersion(FromStorageContext(s.storage), user)
+
+		return err
+	})
+
+	return password, version, err
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions, unless the circuit is open.
+func (s *circuitBreakerStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	var version string
+
+	err := s.call(func() error {
+		var err error
+
+		version, err = SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+
+		return err
+	})
+
+	return version, err
+}
+
+// History returns the versions of the key, if the underlying storage keeps them, unless the circuit is open.
+func (s *circuitBreakerStorage) History(user string) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+
+	err := s.call(func() error {
+		var err error
+
+		entries, err = History(FromStorageContext(s.storage), user)
+
+		return err
+	})
+
+	return entries, err
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history, unless the
+// circuit is open.
+func (s *circuitBreakerStorage) Rollback(user string, version int) error {
+	return s.call(func() error {
+		return Rollback(FromStorageContext(s.storage), user, version)
+	})
+}
+
+// State returns the state of the circuit.
+func (s *circuitBreakerStorage) State() CircuitState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == CircuitOpen && !s.clock.Now().Before(s.openedAt.Add(s.openTimeout)) {
+		return CircuitHalfOpen
+	}
+
+	return s.state
+}
+
+// call calls the operation if the circuit allows it, and records its outcome.
+func (s *circuitBreakerStorage) call(op func() error) error {
+	probe, err := s.acquire()
+	if err != nil {
+		return err
+	}
+
+	err = op()
+
+	s.release(probe, err)
+
+	return err
+}
+
+// acquire checks whether an operation can be called. When the open timeout is over, only one operation probes the
+// storage, the others fail fast until its outcome is known. It returns whether the operation is the probe.
+func (s *circuitBreakerStorage) acquire() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case CircuitClosed:
+		return false, nil
+
+	case CircuitOpen:
+		if s.clock.Now().Before(s.openedAt.Add(s.openTimeout)) {
+			return false, ErrCircuitOpen
+		}
+
+		s.setState(CircuitHalfOpen)
+	}
+
+	if s.probing {
+		return false, ErrCircuitOpen
+	}
+
+	s.probing = true
+
+	return true, nil
+}
+
+// release records the outcome of an operation.
+func (s *circuitBreakerStorage) release(probe bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if probe {
+		s.probing = false
+	}
+
+	// A canceled probe tells nothing about the storage, the next operation probes it again.
+	if probe && errors.Is(err, context.Canceled) {
+		s.setState(CircuitOpen)
+
+		return
+	}
+
+	if err == nil || !s.isFailure(err) {
+		s.failures = 0
+		s.setState(CircuitClosed)
+
+		return
+	}
+
+	s.failures++
+
+	if probe || s.failures >= s.threshold {
+		s.openedAt = s.clock.Now()
+		s.setState(CircuitOpen)
+	}
+}
+
+// setState changes the state and calls the hook. The caller must hold s.mu.
+func (s *circuitBreakerStorage) setState(state CircuitState) {
+	if s.state == state {
+		return
+	}
+
+	from := s.state
+	s.state = state
+
+	if s.stateHook != nil {
+		s.stateHook(from, state)
+	}
+}
+
+// NewCircuitBreakerStorage creates a storage that stops calling the underlying storage after a number of consecutive
+// failures, including the timeouts of the contexts, and fails fast with ErrCircuitOpen instead. After the open timeout,
+// one operation probes the storage: the circuit is closed if it succeeds, or opened again if it fails. A missing entry,
+// a value that is too big, a read-only storage, a conflicting conditional write, a missing version of the history and
+// a canceled context are not failures of the storage.
+//
+// A failure is only counted when the operation returns, so an operation on a keyring that never answers, for example
+// one that waits for an unlock prompt, never opens the circuit. Use WithCircuitCallTimeout, or wrap a storage created
+// by NewTimeoutStorage, to bound the operations.
+func NewCircuitBreakerStorage(storage Storage, options ...CircuitBreakerOption) Storage {
+	s := &circuitBreakerStorage{
+		storage:     ToStorageContext(storage),
+		clock:       clock.New(),
+		threshold:   DefaultCircuitFailureThreshold,
+		openTimeout: DefaultCircuitOpenTimeout,
+		isFailure:   isCircuitFailure,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	if s.callTimeout > 0 {
+		s.storage = ToStorageContext(NewTimeoutStorage(FromStorageContext(s.storage), s.callTimeout))
+	}
+
+	return s
+}
+
+// WithCircuitFailureThreshold sets the number of consecutive failures that opens the circuit.
+func WithCircuitFailureThreshold(threshold int) CircuitBreakerOption {
+	return func(s *circuitBreakerStorage) {
+		s.threshold = threshold
+	}
+}
+
+// WithCircuitOpenTimeout sets how long the circuit stays open before an operation probes the storage again.
+func WithCircuitOpenTimeout(timeout time.Duration) CircuitBreakerOption {
+	return func(s *circuitBreakerStorage) {
+		s.openTimeout = timeout
+	}
+}
+
+// WithCircuitCallTimeout gives up the operations that take longer than the timeout, see NewTimeoutStorage, so they are
+// counted as failures instead of blocking.
+func WithCircuitCallTimeout(timeout time.Duration) CircuitBreakerOption {
+	return func(s *circuitBreakerStorage) {
+		s.callTimeout = timeout
+	}
+}
+
+// WithCircuitFailure sets the function that checks whether an error is a failure of the storage.
+func WithCircuitFailure(isFailure func(err error) bool) CircuitBreakerOption {
+	return func(s *circuitBreakerStorage) {
+		s.isFailure = isFailure
+	}
+}
+
+// WithCircuitStateHook sets a function that is called when the state of the circuit changes, for example to log it. It
+// must not call the storage.
+func WithCircuitStateHook(hook func(from, to CircuitState)) CircuitBreakerOption {
+	return func(s *circuitBreakerStorage) {
+		s.stateHook = hook
+	}
+}
+
+// WithCircuitClock sets the clock of the circuit breaker storage.
+func WithCircuitClock(c clock.Clock) CircuitBreakerOption {
+	return func(s *circuitBreakerStorage) {
+		s.clock = c
+	}
+}
+
+// CircuitStateOf returns the state of the circuit of the storage, for health checks. It returns false if the storage is
+// not a circuit breaker.
+func CircuitStateOf(s Storage) (CircuitState, bool) {
+	b, ok := circuitBreakerOf(s)
+	if !ok {
+		return CircuitClosed, false
+	}
+
+	return b.State(), true
+}
+
+func circuitBreakerOf(s interface{}) (CircuitBreaker, bool) {
+	switch s := s.(type) {
+	case *storageContext:
+		return circuitBreakerOf(s.storage)
+
+	case *storageNoContext:
+		return circuitBreakerOf(s.storage)
+
+	case CircuitBreaker:
+		return s, true
+	}
+
+	return nil, false
+}
+
+func isCircuitFailure(err error) bool {
+	return !errors.Is(err, keyring.ErrNotFound) &&
+		!errors.Is(err, keyring.ErrSetDataTooBig) &&
+		!errors.Is(err, ErrReadOnly) &&
+		!errors.Is(err, ErrConflict) &&
+		!errors.Is(err, ErrHistoryVersionNotFound) &&
+		!errors.Is(err, context.Canceled)
+}
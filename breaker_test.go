@@ -0,0 +1,273 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestCircuitBreakerStorage(t *testing.T) {
+	t.Parallel()
+
+	c := test.NewClock()
+
+	var transitions []string
+
+	s := n26keychain.NewCircuitBreakerStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("", n26keychain.ErrUnavailable).Times(3)
+		s.On("Get", "foo").Return("", keyring.ErrNotFound).Once()
+		s.On("Get", "foo").Return("", n26keychain.ErrUnavailable).Twice()
+		s.On("Get", "foo").Return("bar", nil).Once()
+	})(t),
+		n26keychain.WithCircuitFailureThreshold(2),
+		n26keychain.WithCircuitOpenTimeout(time.Minute),
+		n26keychain.WithCircuitClock(c),
+		n26keychain.WithCircuitStateHook(func(from, to n26keychain.CircuitState) {
+			transitions = append(transitions, fmt.Sprintf("%s -> %s", from, to))
+		}),
+	)
+
+	state := func() n26keychain.CircuitState {
+		st, ok := n26keychain.CircuitStateOf(s)
+		require.True(t, ok)
+
+		return st
+	}
+
+	// A missing entry is not a failure.
+	_, err := s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	assert.Equal(t, n26keychain.CircuitClosed, state())
+
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	assert.Equal(t, n26keychain.CircuitOpen, state())
+
+	// Fail fast.
+	_, err = s.Get("foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+
+	// The probe fails.
+	c.Add(time.Minute)
+
+	assert.Equal(t, n26keychain.CircuitHalfOpen, state())
+
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	assert.Equal(t, n26keychain.CircuitOpen, state())
+
+	// The probe succeeds.
+	c.Add(time.Minute)
+
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, keyring.ErrNotFound)
+
+	assert.Equal(t, n26keychain.CircuitClosed, state())
+
+	// The failures are counted from the last success.
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	assert.Equal(t, n26keychain.CircuitClosed, state())
+
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	assert.Equal(t, n26keychain.CircuitOpen, state())
+
+	c.Add(time.Minute)
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "bar", data)
+	assert.NoError(t, err)
+
+	expected := []string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}
+
+	assert.Equal(t, expected, transitions)
+}
+
+func TestCircuitBreakerStorage_OneProbe(t *testing.T) {
+	t.Parallel()
+
+	c := test.NewClock()
+	probing := make(chan struct{})
+	release := make(chan struct{})
+
+	s := n26keychain.NewCircuitBreakerStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "bar").Return(errors.New("set error")).Once()
+		s.On("Delete", "foo").
+			Run(func(testifyMock.Arguments) {
+				close(probing)
+				<-release
+			}).
+			Return(nil).
+			Once()
+	})(t), n26keychain.WithCircuitFailureThreshold(1), n26keychain.WithCircuitClock(c))
+
+	err := s.Set("foo", "bar")
+	require.EqualError(t, err, "set error")
+
+	_, err = n26keychain.Keys(s)
+
+	assert.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+
+	c.Add(n26keychain.DefaultCircuitOpenTimeout)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.Delete("foo")
+	}()
+
+	<-probing
+
+	// Only one operation probes the storage.
+	_, err = s.Get("foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+
+	close(release)
+
+	require.NoError(t, <-done)
+
+	st, _ := n26keychain.CircuitStateOf(s) //nolint: errcheck
+
+	assert.Equal(t, n26keychain.CircuitClosed, st)
+}
+
+func TestCircuitBreakerStorage_NotFailures(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.ToStorageContext(n26keychain.NewCircuitBreakerStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "bar").Return(keyring.ErrSetDataTooBig)
+	})(t), n26keychain.WithCircuitFailureThreshold(1)))
+
+	err := s.SetContext(context.Background(), "foo", "bar")
+	require.ErrorIs(t, err, keyring.ErrSetDataTooBig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = s.SetContext(ctx, "foo", "bar")
+	require.ErrorIs(t, err, context.Canceled)
+
+	st, _ := n26keychain.CircuitStateOf(n26keychain.FromStorageContext(s)) //nolint: errcheck
+
+	assert.Equal(t, n26keychain.CircuitClosed, st)
+}
+
+func TestCircuitBreakerStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewCircuitBreakerStorage(n26keychain.NewVersionedStorage(memory), n26keychain.WithCircuitFailureThreshold(1))
+
+	version, err := n26keychain.SetIfMatch(s, "foo", "", "bar")
+	require.NoError(t, err)
+
+	password, current, err := n26keychain.GetVersion(s, "foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", password)
+	assert.Equal(t, version, current)
+
+	// A conflict is a failure of the caller, not of the storage.
+	_, err = n26keychain.SetIfMatch(s, "foo", "", "baz")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	st, _ := n26keychain.CircuitStateOf(s) //nolint: errcheck
+
+	assert.Equal(t, n26keychain.CircuitClosed, st)
+
+	// An invalid versioned value is.
+	require.NoError(t, memory.Set("foo", "n26keychain:ver:v1:invalid"))
+
+	_, _, err = n26keychain.GetVersion(s, "foo")
+	require.Error(t, err)
+
+	st, _ = n26keychain.CircuitStateOf(s) //nolint: errcheck
+
+	assert.Equal(t, n26keychain.CircuitOpen, st)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", version, "baz")
+	require.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+}
+
+func TestCircuitBreakerStorage_History(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCircuitBreakerStorage(n26keychain.NewHistoryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo#history").Return("", n26keychain.ErrUnavailable).Once()
+	})(t), 0), n26keychain.WithCircuitFailureThreshold(1))
+
+	_, err := n26keychain.History(s, "foo")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	// The circuit is open, the storage is not called.
+	_, err = n26keychain.History(s, "foo")
+	require.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+
+	err = n26keychain.Rollback(s, "foo", 1)
+	require.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+}
+
+func TestCircuitBreakerStorage_CallTimeout(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan time.Time)
+
+	defer close(block)
+
+	s := n26keychain.NewCircuitBreakerStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").WaitUntil(block).Return("bar", nil).Once()
+	})(t),
+		n26keychain.WithCircuitFailureThreshold(1),
+		n26keychain.WithCircuitCallTimeout(20*time.Millisecond),
+	)
+
+	// The keyring never answers.
+	_, err := s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	st, _ := n26keychain.CircuitStateOf(s) //nolint: errcheck
+
+	assert.Equal(t, n26keychain.CircuitOpen, st)
+
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+}
+
+func TestCircuitStateOf_NotSupported(t *testing.T) {
+	t.Parallel()
+
+	st, ok := n26keychain.CircuitStateOf(n26keychain.NewMemoryStorage())
+
+	assert.Equal(t, n26keychain.CircuitClosed, st)
+	assert.False(t, ok)
+	assert.Equal(t, "CircuitState(42)", n26keychain.CircuitState(42).String())
+}
@@ -0,0 +1,298 @@
+package n26keychain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+)
+
+var (
+	_ Storage        = (*cacheStorage)(nil)
+	_ StorageContext = (*cacheStorage)(nil)
+	_ Lister         = (*cacheStorage)(nil)
+	_ Notifier       = (*cacheStorage)(nil)
+	_ Versioned      = (*cacheStorage)(nil)
+	_ HistoryKeeper  = (*cacheStorage)(nil)
+)
+
+// CacheStorageOption configures the cache storage.
+type CacheStorageOption func(s *cacheStorage)
+
+type cacheEntry struct {
+	password  string
+	found     bool
+	expiresAt time.Time
+}
+
+// keyLock serializes the writes of a key.
+type keyLock struct {
+	mu sync.Mutex
+	// refs is the number of writes that hold or wait for the lock, guarded by cacheStorage.locksMu.
+	refs int
+}
+
+type cacheStorage struct {
+	storage StorageContext
+	clock   clock.Clock
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+	// version changes on every write, so a read that started before a write does not put a stale value in the cache.
+	version uint64
+
+	locksMu sync.Mutex
+	locks   map[string]*keyLock
+}
+
+// Set sets password in the underlying storage and in the cache.
+func (s *cacheStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage and in the cache.
+func (s *cacheStorage) SetContext(ctx context.Context, user, password string) error {
+	unlock := s.lock(user)
+	defer unlock()
+
+	err := s.storage.SetContext(ctx, user, password)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version++
+
+	if err != nil {
+		delete(s.entries, user)
+
+		return err
+	}
+
+	s.entries[user] = cacheEntry{
+		password:  password,
+		found:     true,
+		expiresAt: s.clock.Now().Add(s.ttl),
+	}
+
+	return nil
+}
+
+// Get gets password from the cache, or from the underlying storage if it is not cached or expired.
+func (s *cacheStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the cache, or from the underlying storage if it is not cached or expired.
+func (s *cacheStorage) GetContext(ctx context.Context, user string) (string, error) {
+	s.mu.RLock()
+	entry, ok := s.entries[user]
+	version := s.version
+	s.mu.RUnlock()
+
+	if ok && s.clock.Now().Before(entry.expiresAt) {
+		if !entry.found {
+			return "", keyring.ErrNotFound
+		}
+
+		return entry.password, nil
+	}
+
+	password, err := s.storage.GetContext(ctx, user)
+
+	switch {
+	case err == nil:
+		s.store(user, version, cacheEntry{password: password, found: true, expiresAt: s.clock.Now().Add(s.ttl)})
+
+	case errors.Is(err, keyring.ErrNotFound) && s.negativeTTL > 0:
+		s.store(user, version, cacheEntry{expiresAt: s.clock.Now().Add(s.negativeTTL)})
+	}
+
+	return password, err
+}
+
+// Delete deletes secret from the underlying storage and from the cache.
+func (s *cacheStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage and from the cache.
+func (s *cacheStorage) DeleteContext(ctx context.Context, user string) error {
+	unlock := s.lock(user)
+	defer unlock()
+
+	err := s.storage.DeleteContext(ctx, user)
+
+	s.invalidate(user)
+
+	return err
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *cacheStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications. The cache is cleared
+// before every notification, so the entries that changed are read again from the underlying storage.
+func (s *cacheStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	changes, err := notifyChanges(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		for range changes {
+			s.clear()
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// GetVersion gets password and its version from the underlying storage, if it supports versions. The cache is
+// bypassed, so the version is always the current one.
+func (s *cacheStorage) GetVersion(user string) (string, string, error) {
+	return GetVersion(FromStorageContext(s.storage), user)
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions, and invalidates the cache.
+func (s *cacheStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	unlock := s.lock(user)
+	defer unlock()
+
+	version, err := SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+
+	s.invalidate(user)
+
+	return version, err
+}
+
+// History returns the versions of the key, if the underlying storage keeps them.
+func (s *cacheStorage) History(user string) ([]HistoryEntry, error) {
+	return History(FromStorageContext(s.storage), user)
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history, and
+// invalidates the cache.
+func (s *cacheStorage) Rollback(user string, version int) error {
+	unlock := s.lock(user)
+	defer unlock()
+
+	err := Rollback(FromStorageContext(s.storage), user, version)
+
+	s.invalidate(user)
+
+	return err
+}
+
+// invalidate removes the entry from the cache, and discards the reads that are in flight.
+func (s *cacheStorage) invalidate(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version++
+
+	delete(s.entries, user)
+}
+
+// clear removes all the entries from the cache, and discards the reads that are in flight.
+func (s *cacheStorage) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version++
+	s.entries = make(map[string]cacheEntry)
+}
+
+// lock serializes the writes of the key, so the cache ends up with the value of the last write that reached the
+// underlying storage. It returns the function that unlocks the key.
+func (s *cacheStorage) lock(user string) func() {
+	s.locksMu.Lock()
+
+	l, ok := s.locks[user]
+	if !ok {
+		l = &keyLock{}
+		s.locks[user] = l
+	}
+
+	l.refs++
+
+	s.locksMu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		s.locksMu.Lock()
+		defer s.locksMu.Unlock()
+
+		l.refs--
+
+		if l.refs == 0 {
+			delete(s.locks, user)
+		}
+	}
+}
+
+func (s *cacheStorage) store(user string, version uint64, entry cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.version != version {
+		return
+	}
+
+	s.entries[user] = entry
+}
+
+// NewCacheStorage creates a read-through cache over a storage. Each entry is kept for the given ttl, writes go through
+// to the storage and update the cache, and deletes invalidate it. The writes of a key are serialized, so the cache
+// always ends up with the value of the last one. Not found results are cached as well, see WithNegativeTTL. While the
+// storage is watched, see Watch, the cache is cleared whenever the underlying storage notifies about a change.
+func NewCacheStorage(storage Storage, ttl time.Duration, options ...CacheStorageOption) Storage {
+	s := &cacheStorage{
+		storage:     ToStorageContext(storage),
+		clock:       clock.New(),
+		ttl:         ttl,
+		negativeTTL: ttl,
+		entries:     make(map[string]cacheEntry),
+		locks:       make(map[string]*keyLock),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithNegativeTTL sets how long a not found result is cached. Zero disables the negative caching.
+func WithNegativeTTL(ttl time.Duration) CacheStorageOption {
+	return func(s *cacheStorage) {
+		s.negativeTTL = ttl
+	}
+}
+
+// WithCacheClock sets the clock of the cache storage.
+func WithCacheClock(c clock.Clock) CacheStorageOption {
+	return func(s *cacheStorage) {
+		s.clock = c
+	}
+}
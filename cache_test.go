@@ -0,0 +1,369 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestCacheStorage_Get(t *testing.T) {
+	t.Parallel()
+
+	c := test.NewClock()
+	s := n26keychain.NewCacheStorage(
+		mock.MockStorage(func(s *mock.Storage) {
+			s.On("Get", "key").Return("foo", nil).Once()
+			s.On("Get", "key").Return("bar", nil).Once()
+		})(t),
+		time.Minute,
+		n26keychain.WithCacheClock(c),
+	)
+
+	// 1st run calls storage.
+	result, err := s.Get("key")
+
+	assert.Equal(t, "foo", result)
+	assert.NoError(t, err)
+
+	// 2nd run does not call storage.
+	c.Add(59 * time.Second)
+
+	result, err = s.Get("key")
+
+	assert.Equal(t, "foo", result)
+	assert.NoError(t, err)
+
+	// Expired.
+	c.Add(time.Second)
+
+	result, err = s.Get("key")
+
+	assert.Equal(t, "bar", result)
+	assert.NoError(t, err)
+}
+
+func TestCacheStorage_GetNotFound(t *testing.T) {
+	t.Parallel()
+
+	c := test.NewClock()
+	s := n26keychain.NewCacheStorage(
+		mock.MockStorage(func(s *mock.Storage) {
+			s.On("Get", "key").Return("", keyring.ErrNotFound).Once()
+			s.On("Get", "key").Return("foo", nil).Once()
+		})(t),
+		time.Minute,
+		n26keychain.WithCacheClock(c),
+		n26keychain.WithNegativeTTL(time.Second),
+	)
+
+	// 1st run calls storage.
+	_, err := s.Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// 2nd run does not call storage.
+	_, err = s.Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Expired.
+	c.Add(time.Second)
+
+	result, err := s.Get("key")
+
+	assert.Equal(t, "foo", result)
+	assert.NoError(t, err)
+}
+
+func TestCacheStorage_GetNoNegativeCache(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCacheStorage(
+		mock.MockStorage(func(s *mock.Storage) {
+			s.On("Get", "key").Return("", keyring.ErrNotFound).Twice()
+		})(t),
+		time.Minute,
+		n26keychain.WithNegativeTTL(0),
+	)
+
+	_, err := s.Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	_, err = s.Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestCacheStorage_GetError(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCacheStorage(
+		mock.MockStorage(func(s *mock.Storage) {
+			s.On("Get", "key").Return("", errors.New("get error")).Twice()
+		})(t),
+		time.Minute,
+	)
+
+	// Errors are not cached.
+	_, err := s.Get("key")
+
+	assert.EqualError(t, err, "get error")
+
+	_, err = s.Get("key")
+
+	assert.EqualError(t, err, "get error")
+}
+
+func TestCacheStorage_Set(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCacheStorage(
+		mock.MockStorage(func(s *mock.Storage) {
+			s.On("Get", "key").Return("foo", nil).Once()
+			s.On("Set", "key", "bar").Return(nil).Once()
+			s.On("Set", "key", "baz").Return(errors.New("set error")).Once()
+			s.On("Get", "key").Return("bar", nil).Once()
+		})(t),
+		time.Minute,
+	)
+
+	result, err := s.Get("key")
+
+	assert.Equal(t, "foo", result)
+	assert.NoError(t, err)
+
+	// Write through.
+	err = s.Set("key", "bar")
+	require.NoError(t, err)
+
+	result, err = s.Get("key")
+
+	assert.Equal(t, "bar", result)
+	assert.NoError(t, err)
+
+	// Failed writes invalidate the cache.
+	err = s.Set("key", "baz")
+	require.EqualError(t, err, "set error")
+
+	result, err = s.Get("key")
+
+	assert.Equal(t, "bar", result)
+	assert.NoError(t, err)
+}
+
+func TestCacheStorage_Delete(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCacheStorage(
+		mock.MockStorage(func(s *mock.Storage) {
+			s.On("Get", "key").Return("foo", nil).Once()
+			s.On("Delete", "key").Return(nil).Once()
+			s.On("Get", "key").Return("", keyring.ErrNotFound).Once()
+			s.On("Delete", "key").Return(keyring.ErrNotFound).Once()
+		})(t),
+		time.Minute,
+	)
+
+	result, err := s.Get("key")
+
+	assert.Equal(t, "foo", result)
+	assert.NoError(t, err)
+
+	err = s.Delete("key")
+	require.NoError(t, err)
+
+	_, err = s.Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	err = s.Delete("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestCacheStorage_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewCacheStorage(memory, time.Minute)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_ = s.Set("key", "value")
+			_, _ = s.Get("key")
+			_ = s.Delete("key")
+		}()
+	}
+
+	wg.Wait()
+
+	err := s.Set("key", "value")
+	require.NoError(t, err)
+
+	result, err := s.Get("key")
+
+	assert.Equal(t, "value", result)
+	assert.NoError(t, err)
+}
+
+func TestCacheStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCacheStorage(n26keychain.NewVersionedStorage(n26keychain.NewMemoryStorage()), time.Minute)
+
+	require.NoError(t, s.Set("key", "foo"))
+
+	// The cache bypasses the version.
+	password, version, err := n26keychain.GetVersion(s, "key")
+	require.NoError(t, err)
+
+	assert.Equal(t, "foo", password)
+
+	_, err = n26keychain.SetIfMatch(s, "key", version, "bar")
+	require.NoError(t, err)
+
+	_, err = n26keychain.SetIfMatch(s, "key", version, "baz")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	// The conditional write invalidates the cache.
+	result, err := s.Get("key")
+
+	assert.Equal(t, "bar", result)
+	assert.NoError(t, err)
+}
+
+func TestCacheStorage_History(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCacheStorage(n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0), time.Minute)
+
+	require.NoError(t, s.Set("key", "foo"))
+	require.NoError(t, s.Set("key", "bar"))
+
+	history, err := n26keychain.History(s, "key")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	require.NoError(t, n26keychain.Rollback(s, "key", history[0].Version))
+
+	// The rollback invalidates the cache.
+	result, err := s.Get("key")
+
+	assert.Equal(t, "foo", result)
+	assert.NoError(t, err)
+}
+
+func TestCacheStorage_ConcurrentSet(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	storage := &lateSetStorage{
+		Storage: memory,
+		late:    "first",
+		written: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s := n26keychain.NewCacheStorage(storage, time.Minute)
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		assert.NoError(t, s.Set("key", "first"))
+	}()
+
+	<-storage.written
+
+	go func() {
+		defer wg.Done()
+
+		assert.NoError(t, s.Set("key", "second"))
+	}()
+
+	// Give the second write the time to reach the storage before the first one updates the cache.
+	time.Sleep(50 * time.Millisecond)
+	close(storage.release)
+
+	wg.Wait()
+
+	expected, err := memory.Get("key")
+	require.NoError(t, err)
+
+	result, err := s.Get("key")
+	require.NoError(t, err)
+
+	assert.Equal(t, "second", expected)
+	assert.Equal(t, expected, result)
+}
+
+// lateSetStorage returns from the write of the late value only when it is released, after the value is written.
+type lateSetStorage struct {
+	n26keychain.Storage
+
+	late    string
+	written chan struct{}
+	release chan struct{}
+}
+
+func (s *lateSetStorage) Set(user, password string) error {
+	err := s.Storage.Set(user, password)
+
+	if password == s.late {
+		close(s.written)
+		<-s.release
+	}
+
+	return err
+}
+
+func TestCacheStorage_Notify(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewCacheStorage(memory, time.Hour)
+
+	require.NoError(t, s.Set("foo", "1"))
+
+	// The storage is not polled during the test.
+	events := n26keychain.Watch(ctx, s, "foo", n26keychain.WithPollInterval(time.Hour))
+
+	// Another writer changes the underlying storage, the cache is cleared.
+	require.NoError(t, memory.Set("foo", "2"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "2"}, receiveEvent(t, events))
+
+	password, err := s.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "2", password)
+
+	_, err = s.(n26keychain.Notifier).Notify(ctx)
+	require.NoError(t, err)
+
+	_, err = n26keychain.NewCacheStorage(pollOnly{memory}, time.Hour).(n26keychain.Notifier).Notify(ctx)
+
+	assert.ErrorIs(t, err, n26keychain.ErrNotifyNotSupported)
+}
@@ -0,0 +1,269 @@
+package n26keychain
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+var (
+	_ Storage  = (*chainStorage)(nil)
+	_ Lister   = (*chainStorage)(nil)
+	_ Notifier = (*chainStorage)(nil)
+)
+
+// ChainStorageOption configures the chain storage.
+type ChainStorageOption func(s *chainStorage)
+
+type chainStorage struct {
+	storages   []Storage
+	primary    int
+	writeToAll bool
+}
+
+// Set sets password for user in the primary storage, or in all the storages if configured. When a storage is
+// unavailable, the next one is used.
+func (s *chainStorage) Set(user, password string) error {
+	if s.writeToAll {
+		return s.setAll(user, password)
+	}
+
+	var lastErr error
+
+	for _, storage := range s.writeOrder() {
+		err := storage.Set(user, password)
+		if err == nil || !IsUnavailable(err) {
+			return err
+		}
+
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+func (s *chainStorage) setAll(user, password string) error {
+	var lastErr error
+
+	written := false
+
+	for _, storage := range s.storages {
+		err := storage.Set(user, password)
+		if err == nil {
+			written = true
+
+			continue
+		}
+
+		if !IsUnavailable(err) {
+			return err
+		}
+
+		lastErr = err
+	}
+
+	if written {
+		return nil
+	}
+
+	return lastErr
+}
+
+// Get gets password from the first storage that has it. Unavailable storages are skipped.
+func (s *chainStorage) Get(user string) (string, error) {
+	var lastErr error
+
+	for _, storage := range s.storages {
+		password, err := storage.Get(user)
+		if err == nil {
+			return password, nil
+		}
+
+		if !errors.Is(err, keyring.ErrNotFound) && !IsUnavailable(err) {
+			return "", err
+		}
+
+		if lastErr == nil || !errors.Is(lastErr, keyring.ErrNotFound) {
+			lastErr = err
+		}
+	}
+
+	if lastErr == nil {
+		return "", keyring.ErrNotFound
+	}
+
+	return "", lastErr
+}
+
+// Delete deletes secret from all the storages. Unavailable storages are skipped.
+func (s *chainStorage) Delete(user string) error {
+	var lastErr error
+
+	deleted := false
+
+	for _, storage := range s.storages {
+		err := storage.Delete(user)
+		if err == nil {
+			deleted = true
+
+			continue
+		}
+
+		if !errors.Is(err, keyring.ErrNotFound) && !IsUnavailable(err) {
+			return err
+		}
+
+		if lastErr == nil || !errors.Is(lastErr, keyring.ErrNotFound) {
+			lastErr = err
+		}
+	}
+
+	if deleted {
+		return nil
+	}
+
+	if lastErr == nil {
+		return keyring.ErrNotFound
+	}
+
+	return lastErr
+}
+
+// Keys returns the keys of all the storages that support listing. Unavailable storages are skipped.
+func (s *chainStorage) Keys() ([]string, error) {
+	keys := make(map[string]struct{})
+	listed := false
+
+	var lastErr error
+
+	for _, storage := range s.storages {
+		result, err := Keys(storage)
+		if err != nil {
+			if !errors.Is(err, ErrListNotSupported) && !IsUnavailable(err) {
+				return nil, err
+			}
+
+			lastErr = err
+
+			continue
+		}
+
+		listed = true
+
+		for _, k := range result {
+			keys[k] = struct{}{}
+		}
+	}
+
+	if !listed {
+		if lastErr == nil {
+			return nil, ErrListNotSupported
+		}
+
+		return nil, lastErr
+	}
+
+	return sortedKeys(keys), nil
+}
+
+// Notify notifies about the changes of all the storages that support notifications. The storages that can not notify
+// are skipped, and the error of the last one is returned if none of them can.
+func (s *chainStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	var (
+		changes []<-chan struct{}
+		lastErr error
+	)
+
+	for _, storage := range s.storages {
+		ch, err := notifyChanges(ctx, storage)
+		if err != nil {
+			lastErr = err
+
+			continue
+		}
+
+		changes = append(changes, ch)
+	}
+
+	if len(changes) == 0 {
+		if lastErr == nil {
+			return nil, ErrNotifyNotSupported
+		}
+
+		return nil, lastErr
+	}
+
+	ch := make(chan struct{}, 1)
+
+	var wg sync.WaitGroup
+
+	wg.Add(len(changes))
+
+	for _, c := range changes {
+		go func(c <-chan struct{}) {
+			defer wg.Done()
+
+			for range c {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// writeOrder returns the primary storage first, then the others in order.
+func (s *chainStorage) writeOrder() []Storage {
+	if s.primary <= 0 || s.primary >= len(s.storages) {
+		return s.storages
+	}
+
+	result := make([]Storage, 0, len(s.storages))
+	result = append(result, s.storages[s.primary])
+	result = append(result, s.storages[:s.primary]...)
+	result = append(result, s.storages[s.primary+1:]...)
+
+	return result
+}
+
+// NewChainStorage creates a storage that tries several storages in order. It reads from the first storage that has the
+// key, and writes to the primary storage, which is the first one by default. Storages that are unavailable, see
+// IsUnavailable, are skipped.
+//
+// The versions and the history of the storages are not passed through, because a fallback would bypass them. Wrap the
+// chain storage with NewVersionedStorage or NewHistoryStorage instead.
+func NewChainStorage(storages []Storage, options ...ChainStorageOption) Storage {
+	s := &chainStorage{
+		storages: storages,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithPrimaryStorage sets the index of the storage that is written to.
+func WithPrimaryStorage(index int) ChainStorageOption {
+	return func(s *chainStorage) {
+		s.primary = index
+	}
+}
+
+// WithWriteToAll writes to all the storages instead of the primary one.
+func WithWriteToAll() ChainStorageOption {
+	return func(s *chainStorage) {
+		s.writeToAll = true
+	}
+}
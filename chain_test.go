@@ -0,0 +1,405 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestChainStorage_Get(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario       string
+		mockFirst      mock.StorageMocker
+		mockSecond     mock.StorageMocker
+		expectedResult string
+		expectedError  error
+	}{
+		{
+			scenario: "found in first",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("first", nil)
+			}),
+			mockSecond:     mock.NoMockStorage,
+			expectedResult: "first",
+		},
+		{
+			scenario: "found in second",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", keyring.ErrNotFound)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("second", nil)
+			}),
+			expectedResult: "second",
+		},
+		{
+			scenario: "first is unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", keyring.ErrUnsupportedPlatform)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("second", nil)
+			}),
+			expectedResult: "second",
+		},
+		{
+			scenario: "first fails",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", errors.New("get error"))
+			}),
+			mockSecond:    mock.NoMockStorage,
+			expectedError: errors.New("get error"),
+		},
+		{
+			scenario: "not found and unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", keyring.ErrNotFound)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", keyring.ErrUnsupportedPlatform)
+			}),
+			expectedError: keyring.ErrNotFound,
+		},
+		{
+			scenario: "all unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", n26keychain.ErrUnavailable)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "key").Return("", keyring.ErrUnsupportedPlatform)
+			}),
+			expectedError: keyring.ErrUnsupportedPlatform,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			s := n26keychain.NewChainStorage([]n26keychain.Storage{tc.mockFirst(t), tc.mockSecond(t)})
+
+			result, err := s.Get("key")
+
+			assert.Equal(t, tc.expectedResult, result)
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
+
+func TestChainStorage_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	_, err := n26keychain.NewChainStorage(nil).Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestChainStorage_Set(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		mockFirst     mock.StorageMocker
+		mockSecond    mock.StorageMocker
+		options       []n26keychain.ChainStorageOption
+		expectedError error
+	}{
+		{
+			scenario: "write to first",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(nil)
+			}),
+			mockSecond: mock.NoMockStorage,
+		},
+		{
+			scenario:  "write to primary",
+			mockFirst: mock.NoMockStorage,
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(nil)
+			}),
+			options: []n26keychain.ChainStorageOption{n26keychain.WithPrimaryStorage(1)},
+		},
+		{
+			scenario: "primary is unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(nil)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			options: []n26keychain.ChainStorageOption{n26keychain.WithPrimaryStorage(1)},
+		},
+		{
+			scenario: "primary fails",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(errors.New("set error"))
+			}),
+			mockSecond:    mock.NoMockStorage,
+			expectedError: errors.New("set error"),
+		},
+		{
+			scenario: "all unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(n26keychain.ErrUnavailable)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			expectedError: keyring.ErrUnsupportedPlatform,
+		},
+		{
+			scenario: "write to all",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(nil)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(nil)
+			}),
+			options: []n26keychain.ChainStorageOption{n26keychain.WithWriteToAll()},
+		},
+		{
+			scenario: "write to all with unavailable storage",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(nil)
+			}),
+			options: []n26keychain.ChainStorageOption{n26keychain.WithWriteToAll()},
+		},
+		{
+			scenario: "write to all fails",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(errors.New("set error"))
+			}),
+			mockSecond:    mock.NoMockStorage,
+			options:       []n26keychain.ChainStorageOption{n26keychain.WithWriteToAll()},
+			expectedError: errors.New("set error"),
+		},
+		{
+			scenario: "write to all unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(n26keychain.ErrUnavailable)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "key", "value").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			options:       []n26keychain.ChainStorageOption{n26keychain.WithWriteToAll()},
+			expectedError: keyring.ErrUnsupportedPlatform,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			s := n26keychain.NewChainStorage([]n26keychain.Storage{tc.mockFirst(t), tc.mockSecond(t)}, tc.options...)
+
+			err := s.Set("key", "value")
+
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
+
+func TestChainStorage_Delete(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		mockFirst     mock.StorageMocker
+		mockSecond    mock.StorageMocker
+		expectedError error
+	}{
+		{
+			scenario: "delete from all",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(nil)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(nil)
+			}),
+		},
+		{
+			scenario: "deleted from one",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(nil)
+			}),
+		},
+		{
+			scenario: "not found",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(keyring.ErrNotFound)
+			}),
+			expectedError: keyring.ErrNotFound,
+		},
+		{
+			scenario: "could not delete",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(errors.New("delete error"))
+			}),
+			mockSecond:    mock.NoMockStorage,
+			expectedError: errors.New("delete error"),
+		},
+		{
+			scenario: "all unavailable",
+			mockFirst: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(n26keychain.ErrUnavailable)
+			}),
+			mockSecond: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "key").Return(keyring.ErrUnsupportedPlatform)
+			}),
+			expectedError: keyring.ErrUnsupportedPlatform,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			s := n26keychain.NewChainStorage([]n26keychain.Storage{tc.mockFirst(t), tc.mockSecond(t)})
+
+			err := s.Delete("key")
+
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
+
+func TestChainStorage_Fallback(t *testing.T) {
+	t.Parallel()
+
+	unavailable := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "key").Return("", keyring.ErrUnsupportedPlatform)
+		s.On("Set", "key", "value").Return(keyring.ErrUnsupportedPlatform)
+	})(t)
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChainStorage([]n26keychain.Storage{unavailable, memory})
+
+	err := s.Set("key", "value")
+	require.NoError(t, err)
+
+	result, err := s.Get("key")
+
+	assert.Equal(t, "value", result)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key": "value"}, memory.Snapshot())
+}
+
+func TestChainStorage_FallbackCircuitOpen(t *testing.T) {
+	t.Parallel()
+
+	breaker := n26keychain.NewCircuitBreakerStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "key").Return("", n26keychain.ErrUnavailable).Once()
+	})(t), n26keychain.WithCircuitFailureThreshold(1))
+
+	_, err := breaker.Get("key")
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChainStorage([]n26keychain.Storage{breaker, memory})
+
+	err = s.Set("key", "value")
+	require.NoError(t, err)
+
+	result, err := s.Get("key")
+
+	assert.Equal(t, "value", result)
+	assert.NoError(t, err)
+}
+
+func TestChainStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	unavailable := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "key").Return("", keyring.ErrUnsupportedPlatform)
+		s.On("Set", "key", testifyMock.Anything).Return(keyring.ErrUnsupportedPlatform)
+	})
+	memory := n26keychain.NewMemoryStorage()
+
+	// The versions are not passed through.
+	_, _, err := n26keychain.GetVersion(n26keychain.NewChainStorage([]n26keychain.Storage{n26keychain.NewVersionedStorage(memory)}), "key")
+	require.ErrorIs(t, err, n26keychain.ErrVersionNotSupported)
+
+	_, err = n26keychain.History(n26keychain.NewChainStorage([]n26keychain.Storage{n26keychain.NewHistoryStorage(memory, 0)}), "key")
+	require.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+
+	// The versioned storage wraps the chain storage instead.
+	s := n26keychain.NewVersionedStorage(n26keychain.NewChainStorage([]n26keychain.Storage{unavailable(t), memory}))
+
+	version, err := n26keychain.SetIfMatch(s, "key", "", "value")
+	require.NoError(t, err)
+
+	_, err = n26keychain.SetIfMatch(s, "key", "", "other")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	password, current, err := n26keychain.GetVersion(s, "key")
+	require.NoError(t, err)
+
+	assert.Equal(t, "value", password)
+	assert.Equal(t, version, current)
+}
+
+func TestChainStorage_Notify(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary := n26keychain.NewMemoryStorage()
+	fallback := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChainStorage([]n26keychain.Storage{pollOnly{n26keychain.NewMemoryStorage()}, primary, fallback})
+
+	// The storage is not polled during the test.
+	events := n26keychain.Watch(ctx, s, "foo", n26keychain.WithPollInterval(time.Hour))
+
+	require.NoError(t, fallback.Set("foo", "1"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "1"}, receiveEvent(t, events))
+
+	require.NoError(t, primary.Set("foo", "2"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "2"}, receiveEvent(t, events))
+
+	// The channel is closed when the context is done.
+	ch, err := s.(n26keychain.Notifier).Notify(ctx)
+	require.NoError(t, err)
+
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		select {
+		case _, ok := <-ch:
+			return !ok
+
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+
+	_, err = n26keychain.NewChainStorage([]n26keychain.Storage{pollOnly{primary}}).(n26keychain.Notifier).
+		Notify(context.Background())
+
+	assert.ErrorIs(t, err, n26keychain.ErrNotifyNotSupported)
+}
@@ -0,0 +1,286 @@
+package n26keychain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	// DefaultChunkSize is the chunk size that fits in the limits of all the go-keyring backends.
+	DefaultChunkSize = 2048
+
+	chunkManifestPrefix = "n26keychain:chunked:v1:"
+	chunkKeySeparator   = "#chunk:"
+)
+
+// ErrChunkCorrupted indicates that the chunks of a value are missing or do not match the manifest.
+var ErrChunkCorrupted = errors.New("chunked value is corrupted")
+
+var (
+	_ Storage        = (*chunkedStorage)(nil)
+	_ StorageContext = (*chunkedStorage)(nil)
+	_ Lister         = (*chunkedStorage)(nil)
+	_ Notifier       = (*chunkedStorage)(nil)
+)
+
+type chunkManifest struct {
+	ID     string `json:"id"`
+	Chunks int    `json:"chunks"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type chunkedStorage struct {
+	storage   StorageContext
+	chunkSize int
+}
+
+// Set sets password in the underlying storage, split in several chunks if it is too big.
+func (s *chunkedStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage, split in several chunks if it is too big.
+func (s *chunkedStorage) SetContext(ctx context.Context, user, password string) error {
+	// The chunks of the previous value are removed after the new value is written.
+	previous, err := s.manifest(ctx, user)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) && !errors.Is(err, ErrChunkCorrupted) {
+		return err
+	}
+
+	if len(password) <= s.chunkSize && !strings.HasPrefix(password, chunkManifestPrefix) {
+		if err := s.storage.SetContext(ctx, user, password); err != nil {
+			return err
+		}
+
+		return s.deleteChunks(ctx, user, previous)
+	}
+
+	id, err := newChunkID()
+	if err != nil {
+		return err
+	}
+
+	chunks := splitChunks(password, s.chunkSize)
+	sum := sha256.Sum256([]byte(password))
+
+	// The chunks are written before the manifest, so the manifest never points to missing chunks.
+	for i, chunk := range chunks {
+		if err := s.storage.SetContext(ctx, chunkKey(user, id, i), chunk); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := json.Marshal(chunkManifest{
+		ID:     id,
+		Chunks: len(chunks),
+		Size:   len(password),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.SetContext(ctx, user, chunkManifestPrefix+string(manifest)); err != nil {
+		return err
+	}
+
+	return s.deleteChunks(ctx, user, previous)
+}
+
+// Get gets password from the underlying storage and reassembles its chunks.
+func (s *chunkedStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage and reassembles its chunks.
+func (s *chunkedStorage) GetContext(ctx context.Context, user string) (string, error) {
+	data, err := s.storage.GetContext(ctx, user)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(data, chunkManifestPrefix) {
+		return data, nil
+	}
+
+	manifest, err := parseChunkManifest(data)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+
+	sb.Grow(manifest.Size)
+
+	for i := 0; i < manifest.Chunks; i++ {
+		chunk, err := s.storage.GetContext(ctx, chunkKey(user, manifest.ID, i))
+		if err != nil {
+			if errors.Is(err, keyring.ErrNotFound) {
+				return "", fmt.Errorf("%w: missing chunk %d", ErrChunkCorrupted, i)
+			}
+
+			return "", err
+		}
+
+		sb.WriteString(chunk)
+	}
+
+	password := sb.String()
+	sum := sha256.Sum256([]byte(password))
+
+	if len(password) != manifest.Size || hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return "", fmt.Errorf("%w: checksum mismatch", ErrChunkCorrupted)
+	}
+
+	return password, nil
+}
+
+// Delete deletes secret and all its chunks from the underlying storage.
+func (s *chunkedStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret and all its chunks from the underlying storage.
+func (s *chunkedStorage) DeleteContext(ctx context.Context, user string) error {
+	manifest, err := s.manifest(ctx, user)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) && !errors.Is(err, ErrChunkCorrupted) {
+		return err
+	}
+
+	if err := s.storage.DeleteContext(ctx, user); err != nil {
+		return err
+	}
+
+	return s.deleteChunks(ctx, user, manifest)
+}
+
+// Keys returns all the keys in the underlying storage without the chunks, if it supports listing.
+func (s *chunkedStorage) Keys() ([]string, error) {
+	keys, err := listKeys(s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		if !strings.Contains(k, chunkKeySeparator) {
+			result = append(result, k)
+		}
+	}
+
+	return result, nil
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *chunkedStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// manifest returns the manifest of the stored value, or nil if the value is not chunked.
+func (s *chunkedStorage) manifest(ctx context.Context, user string) (*chunkManifest, error) {
+	data, err := s.storage.GetContext(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(data, chunkManifestPrefix) {
+		return nil, nil //nolint: nilnil
+	}
+
+	return parseChunkManifest(data)
+}
+
+func (s *chunkedStorage) deleteChunks(ctx context.Context, user string, manifest *chunkManifest) error {
+	if manifest == nil {
+		return nil
+	}
+
+	for i := 0; i < manifest.Chunks; i++ {
+		err := s.storage.DeleteContext(ctx, chunkKey(user, manifest.ID, i))
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseChunkManifest(data string) (*chunkManifest, error) {
+	var manifest chunkManifest
+
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, chunkManifestPrefix)), &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrChunkCorrupted, err.Error())
+	}
+
+	if manifest.Chunks < 0 || manifest.Size < 0 {
+		return nil, fmt.Errorf("%w: invalid manifest", ErrChunkCorrupted)
+	}
+
+	return &manifest, nil
+}
+
+func chunkKey(user, id string, index int) string {
+	return fmt.Sprintf("%s%s%s:%d", user, chunkKeySeparator, id, index)
+}
+
+func newChunkID() (string, error) {
+	id := make([]byte, 8)
+
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", fmt.Errorf("could not generate chunk id: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// splitChunks splits the value in chunks of at most size bytes without breaking multibyte characters, because some
+// backends only accept valid UTF-8 strings.
+func splitChunks(value string, size int) []string {
+	chunks := make([]string, 0, len(value)/size+1)
+
+	for len(value) > size {
+		end := size
+
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+
+		if end == 0 {
+			end = size
+		}
+
+		chunks = append(chunks, value[:end])
+		value = value[end:]
+	}
+
+	return append(chunks, value)
+}
+
+// NewChunkedStorage creates a storage that splits the values bigger than chunkSize bytes in several entries, so they
+// fit in the size limit of the backend. The entry of the key holds a manifest that is used for reassembling the value
+// and checking its integrity. DefaultChunkSize is used if chunkSize is not positive.
+//
+// The versions and the history of the underlying storage are not passed through, because they would only cover the
+// manifest and not the chunks. Wrap the chunked storage with NewVersionedStorage or NewHistoryStorage instead.
+func NewChunkedStorage(storage Storage, chunkSize int) Storage {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	return &chunkedStorage{
+		storage:   ToStorageContext(storage),
+		chunkSize: chunkSize,
+	}
+}
@@ -0,0 +1,246 @@
+package n26keychain_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+func TestChunkedStorage_Small(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChunkedStorage(memory, 10)
+
+	err := s.Set("key", "foobar")
+	require.NoError(t, err)
+
+	// Small values are stored as is.
+	assert.Equal(t, map[string]string{"key": "foobar"}, memory.Snapshot())
+
+	data, err := s.Get("key")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+}
+
+func TestChunkedStorage_Big(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChunkedStorage(memory, 10)
+	value := strings.Repeat("0123456789", 4) + "abc"
+
+	err := s.Set("key", value)
+	require.NoError(t, err)
+
+	snapshot := memory.Snapshot()
+
+	assert.Len(t, snapshot, 6)
+	assert.True(t, strings.HasPrefix(snapshot["key"], "n26keychain:chunked:v1:"))
+
+	for k, v := range snapshot {
+		if k != "key" {
+			assert.LessOrEqual(t, len(v), 10)
+		}
+	}
+
+	data, err := s.Get("key")
+
+	assert.Equal(t, value, data)
+	assert.NoError(t, err)
+
+	// Overwrite with another big value.
+	value = strings.Repeat("9876543210", 2) + "x"
+
+	err = s.Set("key", value)
+	require.NoError(t, err)
+
+	assert.Len(t, memory.Snapshot(), 4)
+
+	data, err = s.Get("key")
+
+	assert.Equal(t, value, data)
+	assert.NoError(t, err)
+
+	// Overwrite with a small value.
+	err = s.Set("key", "foobar")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"key": "foobar"}, memory.Snapshot())
+}
+
+func TestChunkedStorage_Delete(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChunkedStorage(memory, 10)
+
+	err := s.Set("key", strings.Repeat("0123456789", 4))
+	require.NoError(t, err)
+
+	err = s.Delete("key")
+	require.NoError(t, err)
+
+	assert.Empty(t, memory.Snapshot())
+
+	_, err = s.Get("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	err = s.Delete("key")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestChunkedStorage_UTF8(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChunkedStorage(memory, 10)
+	value := strings.Repeat("xin chào thế giới ", 5)
+
+	err := s.Set("key", value)
+	require.NoError(t, err)
+
+	for _, v := range memory.Snapshot() {
+		assert.True(t, utf8.ValidString(v))
+	}
+
+	data, err := s.Get("key")
+
+	assert.Equal(t, value, data)
+	assert.NoError(t, err)
+}
+
+func TestChunkedStorage_ManifestPrefix(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewChunkedStorage(memory, 100)
+	value := "n26keychain:chunked:v1:foobar"
+
+	err := s.Set("key", value)
+	require.NoError(t, err)
+
+	// The value is chunked, so it is not mistaken for a manifest.
+	assert.Len(t, memory.Snapshot(), 2)
+
+	data, err := s.Get("key")
+
+	assert.Equal(t, value, data)
+	assert.NoError(t, err)
+}
+
+func TestChunkedStorage_Corrupted(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		corrupt  func(t *testing.T, memory *n26keychain.MemoryStorage)
+	}{
+		{
+			scenario: "invalid manifest",
+			corrupt: func(t *testing.T, memory *n26keychain.MemoryStorage) {
+				t.Helper()
+
+				require.NoError(t, memory.Set("key", "n26keychain:chunked:v1:{"))
+			},
+		},
+		{
+			scenario: "missing chunk",
+			corrupt: func(t *testing.T, memory *n26keychain.MemoryStorage) {
+				t.Helper()
+
+				for k := range memory.Snapshot() {
+					if k != "key" {
+						require.NoError(t, memory.Delete(k))
+
+						return
+					}
+				}
+			},
+		},
+		{
+			scenario: "modified chunk",
+			corrupt: func(t *testing.T, memory *n26keychain.MemoryStorage) {
+				t.Helper()
+
+				for k := range memory.Snapshot() {
+					if k != "key" {
+						require.NoError(t, memory.Set(k, "xxxxxxxxxx"))
+
+						return
+					}
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			memory := n26keychain.NewMemoryStorage()
+			s := n26keychain.NewChunkedStorage(memory, 10)
+
+			err := s.Set("key", strings.Repeat("0123456789", 4))
+			require.NoError(t, err)
+
+			tc.corrupt(t, memory)
+
+			_, err = s.Get("key")
+
+			assert.ErrorIs(t, err, n26keychain.ErrChunkCorrupted)
+
+			// A corrupted value can still be replaced.
+			err = s.Set("key", "foobar")
+			require.NoError(t, err)
+
+			data, err := s.Get("key")
+
+			assert.Equal(t, "foobar", data)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestChunkedStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	value := strings.Repeat("0123456789", 4)
+
+	// The versions are not passed through.
+	_, _, err := n26keychain.GetVersion(n26keychain.NewChunkedStorage(n26keychain.NewVersionedStorage(memory), 10), "key")
+	require.ErrorIs(t, err, n26keychain.ErrVersionNotSupported)
+
+	_, err = n26keychain.History(n26keychain.NewChunkedStorage(n26keychain.NewHistoryStorage(memory, 0), 10), "key")
+	require.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+
+	// The versioned storage wraps the chunked storage instead.
+	s := n26keychain.NewVersionedStorage(n26keychain.NewChunkedStorage(memory, 10))
+
+	_, err = n26keychain.SetIfMatch(s, "key", "", value)
+	require.NoError(t, err)
+
+	password, version, err := n26keychain.GetVersion(s, "key")
+	require.NoError(t, err)
+
+	assert.Equal(t, value, password)
+
+	_, err = n26keychain.SetIfMatch(s, "key", version, value+"abc")
+	require.NoError(t, err)
+
+	data, err := s.Get("key")
+
+	assert.Equal(t, value+"abc", data)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,149 @@
+package n26keychain
+
+import "context"
+
+var (
+	_ StorageContext = (*storageContext)(nil)
+	_ Storage        = (*storageNoContext)(nil)
+)
+
+// StorageContext is a keychain storage that is aware of context.
+type StorageContext interface {
+	// SetContext sets password in keychain for user.
+	SetContext(ctx context.Context, user, password string) error
+	// GetContext gets password from keychain.
+	GetContext(ctx context.Context, user string) (string, error)
+	// DeleteContext deletes secret from keychain.
+	DeleteContext(ctx context.Context, user string) error
+}
+
+type storageContext struct {
+	storage Storage
+}
+
+type storageNoContext struct {
+	storage StorageContext
+}
+
+// SetContext sets password in keychain for user.
+func (s *storageContext) SetContext(ctx context.Context, user, password string) error {
+	return runContext(ctx, func() error {
+		return s.storage.Set(user, password)
+	})
+}
+
+// GetContext gets password from keychain.
+func (s *storageContext) GetContext(ctx context.Context, user string) (string, error) {
+	var password string
+
+	err := runContext(ctx, func() error {
+		var err error
+
+		password, err = s.storage.Get(user)
+
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// DeleteContext deletes secret from keychain.
+func (s *storageContext) DeleteContext(ctx context.Context, user string) error {
+	return runContext(ctx, func() error {
+		return s.storage.Delete(user)
+	})
+}
+
+// Set sets password in keychain for user.
+func (s *storageNoContext) Set(user, password string) error {
+	return s.storage.SetContext(context.Background(), user, password)
+}
+
+// Get gets password from keychain.
+func (s *storageNoContext) Get(user string) (string, error) {
+	return s.storage.GetContext(context.Background(), user)
+}
+
+// Delete deletes secret from keychain.
+func (s *storageNoContext) Delete(user string) error {
+	return s.storage.DeleteContext(context.Background(), user)
+}
+
+// Keys returns all the keys in the storage, if it supports listing.
+func (s *storageContext) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Keys returns all the keys in the storage, if it supports listing.
+func (s *storageNoContext) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the storage, if it supports notifications.
+func (s *storageContext) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// Notify notifies about the changes of the storage, if it supports notifications.
+func (s *storageNoContext) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// runContext runs the function in a goroutine and stops waiting for it when the context is done. The function itself
+// is not interrupted.
+func runContext(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- fn()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case err := <-result:
+		return err
+	}
+}
+
+// ToStorageContext makes a storage aware of context. If the storage already implements StorageContext, it is returned
+// as is. Otherwise, the calls return as soon as the context is done, even if the underlying call is still blocking.
+//
+// The underlying call is abandoned, not aborted: a write that returned a context error may still complete afterwards,
+// so its outcome is unknown.
+func ToStorageContext(s Storage) StorageContext {
+	switch s := s.(type) {
+	case *storageNoContext:
+		return s.storage
+
+	case StorageContext:
+		return s
+	}
+
+	return &storageContext{storage: s}
+}
+
+// FromStorageContext turns a StorageContext into a Storage that calls it with context.Background().
+func FromStorageContext(s StorageContext) Storage {
+	switch s := s.(type) {
+	case *storageContext:
+		return s.storage
+
+	case Storage:
+		return s
+	}
+
+	return &storageNoContext{storage: s}
+}
@@ -0,0 +1,139 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestStorageContext(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.ToStorageContext(n26keychain.NewMemoryStorage())
+	ctx := context.Background()
+
+	// Get not found.
+	data, err := s.GetContext(ctx, "test")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Set.
+	err = s.SetContext(ctx, "test", "foobar")
+	require.NoError(t, err)
+
+	data, err = s.GetContext(ctx, "test")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+
+	// Delete.
+	err = s.DeleteContext(ctx, "test")
+	require.NoError(t, err)
+
+	data, err = s.GetContext(ctx, "test")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestStorageContext_Canceled(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan time.Time)
+
+	t.Cleanup(func() {
+		close(block)
+	})
+
+	s := n26keychain.ToStorageContext(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "test").WaitUntil(block).Return("foobar", nil)
+		s.On("Set", "test", "foobar").WaitUntil(block).Return(nil)
+	})(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	data, err := s.GetContext(ctx, "test")
+
+	assert.Empty(t, data)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The deadline is exceeded, the storage is not called anymore.
+	err = s.DeleteContext(ctx, "test")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err = s.SetContext(ctx, "test", "foobar")
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStorageContext_Error(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.ToStorageContext(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "test").Return("", errors.New("get error"))
+	})(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data, err := s.GetContext(ctx, "test")
+
+	assert.Empty(t, data)
+	assert.EqualError(t, err, "get error")
+}
+
+func TestFromStorageContext(t *testing.T) {
+	t.Parallel()
+
+	sc := n26keychain.ToStorageContext(n26keychain.NewMemoryStorage())
+
+	err := sc.SetContext(context.Background(), "test", "foobar")
+	require.NoError(t, err)
+
+	s := n26keychain.FromStorageContext(contextOnly{sc})
+
+	data, err := s.Get("test")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+
+	err = s.Set("test", "baz")
+	require.NoError(t, err)
+
+	err = s.Delete("test")
+	require.NoError(t, err)
+
+	_, err = s.Get("test")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestStorageContext_Unwrap(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewMemoryStorage()
+	sc := contextOnly{n26keychain.ToStorageContext(s)}
+
+	assert.Same(t, s, n26keychain.FromStorageContext(n26keychain.ToStorageContext(s)))
+	assert.Equal(t, sc, n26keychain.ToStorageContext(n26keychain.FromStorageContext(sc)))
+}
+
+// contextOnly hides the Storage methods of a StorageContext.
+type contextOnly struct {
+	n26keychain.StorageContext
+}
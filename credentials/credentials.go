@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/bool64/ctxd"
 	"github.com/google/uuid"
 	"github.com/nhatthm/n26api"
 	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
 
 	"github.com/nhatthm/n26keychain"
 )
@@ -36,71 +39,225 @@ type Option func(p *Credentials)
 
 // Credentials provides credentials from keychain.
 type Credentials struct {
-	storage n26keychain.Storage
+	storage n26keychain.StorageContext
 	logger  ctxd.Logger
+	clock   clock.Clock
+
+	serviceNamespace string
+	keyNamespace     string
+
+	tracing        bool
+	tracingOptions []n26keychain.TracingOption
+
+	readOnly bool
+	index    bool
 
 	mu sync.Mutex
 
+	maxAge time.Duration
+
 	key      string
 	loaded   bool
+	loadedAt time.Time
 	username string
 	password string
+	err      error
 }
 
-func (c *Credentials) load() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// load loads the credentials from keychain. The caller must hold c.mu, so concurrent callers wait for the same load
+// instead of loading again.
+func (c *Credentials) load(ctx context.Context) error {
+	data, err := c.storage.GetContext(ctx, c.key)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		c.logger.Error(ctx, "could not get credentials", "error", err)
+	}
 
+	return c.set(ctx, data, err)
+}
+
+// set replaces the loaded credentials with the data from keychain. When the credentials could not be read, the
+// previous ones are kept, unless they are missing or corrupted. The caller must hold c.mu.
+func (c *Credentials) set(ctx context.Context, data string, err error) error {
 	c.loaded = true
-	c.username = ""
-	c.password = ""
+	c.loadedAt = c.clock.Now()
+	c.err = nil
 
-	data, err := c.storage.Get(c.key)
 	if err != nil {
-		if !errors.Is(err, keyring.ErrNotFound) {
-			c.logger.Error(context.Background(), "could not get credentials", "error", err)
+		c.err = loadError(err)
+
+		if errors.Is(c.err, ErrNotFound) || errors.Is(c.err, ErrCorrupted) {
+			c.username = ""
+			c.password = ""
 		}
 
-		return
+		// A transient failure is not kept, so the credentials are loaded again on the next use.
+		if isTransient(err) {
+			c.loaded = false
+		}
+
+		return c.err
 	}
 
 	var t credentials
 
 	if err := json.Unmarshal([]byte(data), &t); err != nil {
-		c.logger.Error(context.Background(), "could not unmarshal credentials", "error", err)
+		c.logger.Error(ctx, "could not unmarshal credentials", "error", err)
+
+		c.username = ""
+		c.password = ""
+		c.err = fmt.Errorf("%w: %w", ErrCorrupted, err)
 
-		return
+		return c.err
 	}
 
-	c.loaded = true
 	c.username = t.Username
 	c.password = t.Password
+
+	return nil
 }
 
-// Username returns the username from keychain.
-func (c *Credentials) Username() string {
-	if c.loaded {
-		return c.username
+// needsLoad checks whether the credentials are not loaded yet or are older than the max age. The caller must hold c.mu.
+func (c *Credentials) needsLoad() bool {
+	if !c.loaded {
+		return true
+	}
+
+	return c.maxAge > 0 && !c.clock.Now().Before(c.loadedAt.Add(c.maxAge))
+}
+
+// Load loads the credentials from keychain if they are not loaded yet or are older than the max age, and returns the
+// error of the load. The error is one of ErrNotFound, ErrUnavailable or ErrCorrupted when the cause is known. A
+// transient failure, see n26keychain.IsRetryable, is not kept, and the credentials are loaded again on the next use.
+// When the credentials can not be read again, the previous ones are kept, unless they are missing or corrupted.
+func (c *Credentials) Load(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.needsLoad() {
+		return c.err
+	}
+
+	return c.load(ctx)
+}
+
+// Reload loads the credentials from keychain, even if they are already loaded, for example after another process
+// rotated the password.
+func (c *Credentials) Reload(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.load(ctx)
+}
+
+// Invalidate marks the credentials as stale, so they are loaded from keychain on the next use.
+func (c *Credentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loaded = false
+}
+
+// InvalidateOnAuthFailure invalidates the credentials if the error returned by n26api is an authentication failure,
+// see IsAuthFailure. It returns whether the credentials were invalidated.
+func (c *Credentials) InvalidateOnAuthFailure(err error) bool {
+	if !IsAuthFailure(err) {
+		return false
 	}
 
-	c.load()
+	c.Invalidate()
+
+	return true
+}
+
+// Err returns the error of the last load, or nil if the credentials were loaded successfully or are not loaded yet.
+func (c *Credentials) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// get returns a consistent snapshot of the credentials, loading them from keychain if they are not loaded yet or are
+// older than the max age.
+func (c *Credentials) get(ctx context.Context) (credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.needsLoad() {
+		_ = c.load(ctx) //nolint: errcheck
+	}
+
+	return credentials{Username: c.username, Password: c.password}, c.err
+}
+
+// Get returns the username and the password from keychain. Unlike calling Username and Password one after another,
+// they always belong to the same credentials, even if the credentials are updated concurrently.
+func (c *Credentials) Get(ctx context.Context) (string, string, error) {
+	t, err := c.get(ctx)
 
-	return c.username
+	return t.Username, t.Password, err
+}
+
+// Username returns the username from keychain.
+func (c *Credentials) Username() string {
+	t, _ := c.get(context.Background()) //nolint: errcheck
+
+	return t.Username
 }
 
 // Password returns the password from keychain.
 func (c *Credentials) Password() string {
-	if c.loaded {
-		return c.password
+	t, _ := c.get(context.Background()) //nolint: errcheck
+
+	return t.Password
+}
+
+// Watch watches the credentials in keychain in background, until the context is done. When they change, for example
+// after a login from another process, the loaded credentials are replaced and the callback is called with the new
+// ones, or with ErrNotFound if they are deleted.
+func (c *Credentials) Watch(
+	ctx context.Context,
+	callback func(username, password string, err error),
+	options ...n26keychain.WatchOption,
+) {
+	events := n26keychain.Watch(ctx, n26keychain.FromStorageContext(c.storage), c.key, options...)
+
+	go func() {
+		for e := range events {
+			t, err := c.apply(ctx, e)
+
+			callback(t.Username, t.Password, err)
+		}
+	}()
+}
+
+// apply replaces the loaded credentials with the watched ones.
+func (c *Credentials) apply(ctx context.Context, e n26keychain.WatchEvent) (credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+
+	if e.Deleted {
+		err = keyring.ErrNotFound
 	}
 
-	c.load()
+	err = c.set(ctx, e.Value, err)
 
-	return c.password
+	return credentials{Username: c.username, Password: c.password}, err
 }
 
 // Update persists new credentials to keychain.
 func (c *Credentials) Update(username, password string) error {
+	return c.UpdateContext(context.Background(), username, password)
+}
+
+// UpdateContext persists new credentials to keychain.
+func (c *Credentials) UpdateContext(ctx context.Context, username, password string) error {
+	if c.readOnly {
+		return fmt.Errorf("could not update credentials: %w", n26keychain.ErrReadOnly)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -112,38 +269,77 @@ func (c *Credentials) Update(username, password string) error {
 		return err
 	}
 
-	if err := c.storage.Set(c.key, string(data)); err != nil {
+	if err := c.storage.SetContext(ctx, c.key, string(data)); err != nil {
+		c.forgetIfAbandoned(err)
+
 		return err
 	}
 
 	c.loaded = true
+	c.loadedAt = c.clock.Now()
 	c.username = username
 	c.password = password
+	c.err = nil
 
 	return nil
 }
 
+// History returns the previous versions of the credentials, if the keychain storage keeps them, see
+// n26keychain.NewHistoryStorage. The values are the credentials as they are stored in keychain.
+func (c *Credentials) History() ([]n26keychain.HistoryEntry, error) {
+	return n26keychain.History(n26keychain.FromStorageContext(c.storage), c.key)
+}
+
+// Rollback restores a previous version of the credentials in keychain, for example after an update with a wrong
+// password, and loads them.
+func (c *Credentials) Rollback(ctx context.Context, version int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := n26keychain.Rollback(n26keychain.FromStorageContext(c.storage), c.key, version); err != nil {
+		return err
+	}
+
+	return c.load(ctx)
+}
+
 // Delete deletes the credentials in keychain.
 func (c *Credentials) Delete() error {
+	return c.DeleteContext(context.Background())
+}
+
+// DeleteContext deletes the credentials in keychain.
+func (c *Credentials) DeleteContext(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if err := c.storage.Delete(c.key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+	if err := c.storage.DeleteContext(ctx, c.key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		c.forgetIfAbandoned(err)
+
 		return err
 	}
 
 	c.loaded = false
 	c.username = ""
 	c.password = ""
+	c.err = nil
 
 	return nil
 }
 
+// forgetIfAbandoned makes the next read load the credentials again when a write was given up, because the write may
+// still complete in keychain.
+func (c *Credentials) forgetIfAbandoned(err error) {
+	if isContextError(err) {
+		c.loaded = false
+	}
+}
+
 // New initiates a new Credentials.
 func New(deviceID uuid.UUID, options ...Option) *Credentials {
 	c := &Credentials{
-		storage: n26keychain.NewStorage(credentialsService),
-		logger:  ctxd.NoOpLogger{},
+		logger: ctxd.NoOpLogger{},
+		clock:  clock.New(),
 
 		key: deviceID.String(),
 	}
@@ -152,16 +348,78 @@ func New(deviceID uuid.UUID, options ...Option) *Credentials {
 		o(c)
 	}
 
+	if c.storage == nil {
+		c.storage = n26keychain.ToStorageContext(
+			n26keychain.NewStorage(n26keychain.NamespacedService(credentialsService, c.serviceNamespace)),
+		)
+	}
+
+	if c.index {
+		c.storage = n26keychain.ToStorageContext(n26keychain.NewIndexedStorage(n26keychain.FromStorageContext(c.storage)))
+	}
+
+	if c.tracing {
+		c.storage = n26keychain.ToStorageContext(n26keychain.NewTracingStorage(
+			n26keychain.FromStorageContext(c.storage),
+			n26keychain.NamespacedService(credentialsService, c.serviceNamespace),
+			c.tracingOptions...,
+		))
+	}
+
+	if c.readOnly {
+		c.storage = n26keychain.ToStorageContext(n26keychain.NewReadOnlyStorage(n26keychain.FromStorageContext(c.storage)))
+	}
+
+	if c.keyNamespace != "" {
+		c.storage = n26keychain.ToStorageContext(
+			n26keychain.NewNamespacedStorage(n26keychain.FromStorageContext(c.storage), c.keyNamespace),
+		)
+	}
+
 	return c
 }
 
+// NewLoaded initiates a new Credentials and loads them from keychain, so the client does not log in with empty
+// credentials when they are missing, unavailable or corrupted. The error is the one of Load.
+func NewLoaded(ctx context.Context, deviceID uuid.UUID, options ...Option) (*Credentials, error) {
+	c := New(deviceID, options...)
+
+	if err := c.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
 // WithStorage sets storage for Credentials.
 func WithStorage(storage n26keychain.Storage) Option {
+	return func(p *Credentials) {
+		p.storage = n26keychain.ToStorageContext(storage)
+	}
+}
+
+// WithStorageContext sets a context-aware storage for Credentials.
+func WithStorageContext(storage n26keychain.StorageContext) Option {
 	return func(p *Credentials) {
 		p.storage = storage
 	}
 }
 
+// WithServiceNamespace appends the namespace to the keychain service of Credentials, for example
+// "n26api.credentials.staging". It has no effect when the storage is set with WithStorage or WithStorageContext.
+func WithServiceNamespace(namespace string) Option {
+	return func(p *Credentials) {
+		p.serviceNamespace = namespace
+	}
+}
+
+// WithKeyNamespace prefixes the key of Credentials with the namespace, see n26keychain.NewNamespacedStorage.
+func WithKeyNamespace(namespace string) Option {
+	return func(p *Credentials) {
+		p.keyNamespace = namespace
+	}
+}
+
 // WithLogger sets logger for Credentials.
 func WithLogger(logger ctxd.Logger) Option {
 	return func(p *Credentials) {
@@ -169,9 +427,82 @@ func WithLogger(logger ctxd.Logger) Option {
 	}
 }
 
-// WithCredentialsProvider sets keychain as a credential provider.
+// WithMaxAge sets how long the loaded credentials are used before they are loaded from keychain again. Zero, the
+// default, keeps them until they are reloaded, invalidated or deleted.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(p *Credentials) {
+		p.maxAge = maxAge
+	}
+}
+
+// WithClock sets the clock of Credentials.
+func WithClock(c clock.Clock) Option {
+	return func(p *Credentials) {
+		p.clock = c
+	}
+}
+
+// WithTracing records the operations of the storage of Credentials in OpenTelemetry spans, see
+// n26keychain.NewTracingStorage. The spans are children of the context of Load, Reload, Get, UpdateContext and
+// DeleteContext. With WithCredentialsProvider, the calls of the n26 client are also recorded, see
+// NewTracingCredentials, and the spans of the storage are their children.
+func WithTracing(options ...n26keychain.TracingOption) Option {
+	return func(p *Credentials) {
+		p.tracing = true
+		p.tracingOptions = options
+	}
+}
+
+// WithReadOnly makes Credentials never change the credentials in keychain, for example for reporting jobs. Update,
+// Delete and Rollback return ErrReadOnly of n26keychain, and the loaded credentials are kept.
+func WithReadOnly() Option {
+	return func(p *Credentials) {
+		p.readOnly = true
+	}
+}
+
+// WithIndex keeps the list of the devices that have credentials in the storage, see n26keychain.NewIndexedStorage, so
+// they can be listed with Credentials.DeviceIDs even when the storage can not enumerate its entries, like the system
+// keyring. The credentials that were set before the index was used are not listed.
+func WithIndex() Option {
+	return func(p *Credentials) {
+		p.index = true
+	}
+}
+
+// WithCredentialsProvider sets keychain as a credential provider. The credentials are loaded on the first use, use
+// WithLoadedCredentialsProvider to fail before the client is created when they can not be loaded.
 func WithCredentialsProvider(options ...Option) n26api.Option {
 	return func(c *n26api.Client) {
-		n26api.WithCredentialsProvider(New(c.DeviceID(), options...))(c)
+		n26api.WithCredentialsProvider(newProvider(c.DeviceID(), options...))(c)
+	}
+}
+
+// WithLoadedCredentialsProvider loads the credentials from keychain and sets keychain as a credential provider, so the
+// client is not created when the credentials are missing, unavailable or corrupted, see NewLoaded. The device ID must
+// be the one of the client, see n26api.WithDeviceID.
+func WithLoadedCredentialsProvider(ctx context.Context, deviceID uuid.UUID, options ...Option) (n26api.Option, error) {
+	c, err := NewLoaded(ctx, deviceID, options...)
+	if err != nil {
+		return nil, err
 	}
+
+	return n26api.WithCredentialsProvider(provider(c, deviceID)), nil
+}
+
+// newProvider creates the credentials provider of the n26 client, with the decorators of the options.
+func newProvider(deviceID uuid.UUID, options ...Option) KeychainCredentials {
+	return provider(New(deviceID, options...), deviceID)
+}
+
+// provider decorates the credentials for the n26 client, according to their options.
+func provider(c *Credentials, deviceID uuid.UUID) KeychainCredentials {
+	if !c.tracing {
+		return c
+	}
+
+	return NewTracingCredentials(c, deviceID,
+		n26keychain.NamespacedService(credentialsService, c.serviceNamespace),
+		c.tracingOptions...,
+	)
 }
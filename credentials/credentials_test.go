@@ -3,11 +3,16 @@
 package credentials
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bool64/ctxd"
 	"github.com/google/uuid"
+	"github.com/nhatthm/n26api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/zalando/go-keyring"
@@ -265,6 +270,35 @@ func TestCredentials_UpdateOnce(t *testing.T) {
 	assert.Equal(t, expectedPassword, c.Password())
 }
 
+func TestCredentials_UpdateAbandoned(t *testing.T) {
+	deviceID := uuid.New()
+
+	storage := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).
+			Return(`{"username":"foo","password":"bar"}`, nil).
+			Once()
+
+		s.On("Set", deviceID.String(), `{"username":"john","password":"doe"}`).
+			Return(context.DeadlineExceeded)
+
+		// The write completed after it was given up.
+		s.On("Get", deviceID.String()).
+			Return(`{"username":"john","password":"doe"}`, nil).
+			Once()
+	})(t)
+
+	c := New(deviceID, WithStorage(storage))
+
+	assert.Equal(t, "foo", c.Username())
+
+	err := c.Update("john", "doe")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The credentials are loaded again.
+	assert.Equal(t, "john", c.Username())
+	assert.Equal(t, "doe", c.Password())
+}
+
 func TestCredentials_UpdateKeyring(t *testing.T) {
 	deviceID := uuid.New()
 
@@ -375,6 +409,34 @@ func TestCredentials_DeleteOnce(t *testing.T) {
 	assert.Empty(t, c.Password())
 }
 
+func TestCredentials_DeleteAbandoned(t *testing.T) {
+	deviceID := uuid.New()
+
+	storage := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).
+			Return(`{"username":"foo","password":"bar"}`, nil).
+			Once()
+
+		s.On("Delete", deviceID.String()).
+			Return(context.Canceled)
+
+		// The delete completed after it was given up.
+		s.On("Get", deviceID.String()).
+			Return("", keyring.ErrNotFound).
+			Once()
+	})(t)
+
+	c := New(deviceID, WithStorage(storage))
+
+	assert.Equal(t, "foo", c.Username())
+
+	err := c.Delete()
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The credentials are loaded again.
+	assert.Empty(t, c.Username())
+}
+
 func TestCredentials_DeleteKeyring(t *testing.T) {
 	deviceID := uuid.New()
 
@@ -401,3 +463,778 @@ func TestCredentials_DeleteKeyring(t *testing.T) {
 		assert.Equal(t, keyring.ErrNotFound, err)
 	})
 }
+
+func TestCredentials_ContextCanceled(t *testing.T) {
+	deviceID := uuid.New()
+
+	storage := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).
+			Return(`{"username":"foo","password":"bar"}`, nil).
+			Once()
+	})(t)
+
+	c := New(deviceID, WithStorage(storage))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.UpdateContext(ctx, "john", "doe")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = c.DeleteContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The credentials are not changed.
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+}
+
+func TestCredentials_WithStorageContext(t *testing.T) {
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorageContext(n26keychain.ToStorageContext(n26keychain.NewMemoryStorage())))
+
+	err := c.UpdateContext(context.Background(), "foo", "bar")
+	require.NoError(t, err)
+
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+
+	err = c.DeleteContext(context.Background())
+	require.NoError(t, err)
+
+	assert.Empty(t, c.Username())
+	assert.Empty(t, c.Password())
+}
+
+func TestCredentials_WithKeyNamespace(t *testing.T) {
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+
+	staging := New(deviceID, WithStorage(s), WithKeyNamespace("staging"))
+	production := New(deviceID, WithStorage(s), WithKeyNamespace("production"))
+
+	err := staging.Update("foo", "bar")
+	require.NoError(t, err)
+
+	assert.Equal(t, "foo", staging.Username())
+	assert.Empty(t, production.Username())
+
+	expected := map[string]string{
+		"staging:" + deviceID.String(): `{"username":"foo","password":"bar"}`,
+	}
+
+	assert.Equal(t, expected, s.Snapshot())
+}
+
+func TestCredentials_WithServiceNamespaceKeyring(t *testing.T) {
+	deviceID := uuid.New()
+	service := n26keychain.NamespacedService(credentialsService, "staging")
+
+	expect := func(t *testing.T, s n26keychain.Storage) { //nolint: thelper
+		err := s.Set(deviceID.String(), `{"username":"foo","password":"bar"}`)
+		require.NoError(t, err)
+	}
+
+	test.Run(t, service, deviceID.String(), expect, func(t *testing.T) { //nolint: thelper
+		assert.Equal(t, "foo", New(deviceID, WithServiceNamespace("staging")).Username())
+		assert.Empty(t, New(deviceID).Username())
+	})
+}
+
+func TestCredentials_Load(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	testCases := []struct {
+		scenario         string
+		mockStorage      mock.StorageMocker
+		expectedUsername string
+		expectedError    error
+	}{
+		{
+			scenario: "not found",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", deviceID.String()).Return("", keyring.ErrNotFound)
+			}),
+			expectedError: ErrNotFound,
+		},
+		{
+			scenario: "unavailable",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", deviceID.String()).Return("", keyring.ErrUnsupportedPlatform)
+			}),
+			expectedError: ErrUnavailable,
+		},
+		{
+			scenario: "could not decrypt",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", deviceID.String()).Return("", n26keychain.ErrDecryptionFailed)
+			}),
+			expectedError: ErrCorrupted,
+		},
+		{
+			scenario: "wrong format",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", deviceID.String()).Return("{", nil)
+			}),
+			expectedError: ErrCorrupted,
+		},
+		{
+			scenario: "success",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil)
+			}),
+			expectedUsername: "foo",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			c := New(deviceID, WithStorage(tc.mockStorage(t)))
+
+			assert.NoError(t, c.Err())
+
+			err := c.Load(context.Background())
+
+			assert.ErrorIs(t, err, tc.expectedError)
+			assert.ErrorIs(t, c.Err(), tc.expectedError)
+			assert.Equal(t, tc.expectedUsername, c.Username())
+
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCredentials_LoadError(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return("", errors.New("get error"))
+	})(t)))
+
+	err := c.Load(context.Background())
+
+	assert.EqualError(t, err, "could not get credentials: get error")
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.NotErrorIs(t, err, ErrUnavailable)
+	assert.NotErrorIs(t, err, ErrCorrupted)
+}
+
+func TestCredentials_ErrAfterUsername(t *testing.T) {
+	t.Parallel()
+
+	c := New(uuid.New(), WithStorage(n26keychain.NewMemoryStorage()))
+
+	assert.Empty(t, c.Username())
+	assert.ErrorIs(t, c.Err(), ErrNotFound)
+
+	err := c.Update("foo", "bar")
+	require.NoError(t, err)
+
+	assert.NoError(t, c.Err())
+}
+
+func TestCredentials_CircuitOpen(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	c := test.NewClock()
+
+	breaker := n26keychain.NewCircuitBreakerStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return("", n26keychain.ErrUnavailable).Once()
+		s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil).Once()
+	})(t),
+		n26keychain.WithCircuitFailureThreshold(1),
+		n26keychain.WithCircuitOpenTimeout(time.Minute),
+		n26keychain.WithCircuitClock(c),
+	)
+
+	// The circuit opens.
+	_, err := breaker.Get(deviceID.String())
+	require.ErrorIs(t, err, n26keychain.ErrUnavailable)
+
+	p := New(deviceID, WithStorage(breaker))
+
+	username, _, err := p.Get(context.Background())
+
+	assert.Empty(t, username)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, n26keychain.ErrCircuitOpen)
+
+	// The circuit recovers, the credentials are loaded again.
+	c.Add(time.Minute)
+
+	username, password, err := p.Get(context.Background())
+
+	assert.Equal(t, "foo", username)
+	assert.Equal(t, "bar", password)
+	assert.NoError(t, err)
+}
+
+func TestNewLoaded(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+
+	c, err := NewLoaded(context.Background(), deviceID, WithStorage(s))
+
+	assert.Nil(t, c)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "credentials not found: secret not found in keyring")
+
+	err = New(deviceID, WithStorage(s)).Update("foo", "bar")
+	require.NoError(t, err)
+
+	c, err = NewLoaded(context.Background(), deviceID, WithStorage(s))
+	require.NoError(t, err)
+
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+}
+
+func TestWithLoadedCredentialsProvider(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+
+	o, err := WithLoadedCredentialsProvider(context.Background(), deviceID, WithStorage(s))
+
+	assert.Nil(t, o)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = New(deviceID, WithStorage(s)).Update("foo", "bar")
+	require.NoError(t, err)
+
+	o, err = WithLoadedCredentialsProvider(context.Background(), deviceID, WithStorage(s))
+	require.NoError(t, err)
+
+	assert.NotNil(t, n26api.NewClient(n26api.WithDeviceID(deviceID), o))
+}
+
+func TestCredentials_Get(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(n26keychain.NewMemoryStorage()))
+
+	username, password, err := c.Get(context.Background())
+
+	assert.Empty(t, username)
+	assert.Empty(t, password)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = c.Update("foo", "bar")
+	require.NoError(t, err)
+
+	username, password, err = c.Get(context.Background())
+
+	assert.Equal(t, "foo", username)
+	assert.Equal(t, "bar", password)
+	assert.NoError(t, err)
+}
+
+func TestCredentials_ConcurrentLoadOnce(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	storage := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).
+			After(10*time.Millisecond).
+			Return(`{"username":"foo","password":"bar"}`, nil).
+			Once()
+	})(t)
+
+	c := New(deviceID, WithStorage(storage))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			assert.Equal(t, "foo", c.Username())
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			assert.Equal(t, "bar", c.Password())
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestCredentials_ConcurrentUpdate(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(n26keychain.NewMemoryStorage()))
+
+	err := c.Update("foo", "foo")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		value := fmt.Sprintf("user%d", i)
+		deleting := i%5 == 0
+
+		wg.Add(4)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, c.Update(value, value))
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			// The username and the password always belong to the same credentials.
+			username, password, _ := c.Get(context.Background())
+
+			assert.Equal(t, username, password)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			_ = c.Username()
+			_ = c.Password()
+			_ = c.Err()
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			if deleting {
+				assert.NoError(t, c.Delete())
+			} else {
+				_ = c.Load(context.Background())
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestCredentials_Reload(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+
+	c := New(deviceID, WithStorage(s))
+
+	err := c.Update("foo", "bar")
+	require.NoError(t, err)
+
+	// Another process rotates the password.
+	err = s.Set(deviceID.String(), `{"username":"foo","password":"baz"}`)
+	require.NoError(t, err)
+
+	// Load does not read the keychain again.
+	err = c.Load(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", c.Password())
+
+	err = c.Reload(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "baz", c.Password())
+
+	// Reload fails.
+	err = s.Delete(deviceID.String())
+	require.NoError(t, err)
+
+	err = c.Reload(context.Background())
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, c.Password())
+}
+
+func TestCredentials_MaxAge(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+	clock := test.NewClock()
+
+	err := s.Set(deviceID.String(), `{"username":"foo","password":"bar"}`)
+	require.NoError(t, err)
+
+	c := New(deviceID, WithStorage(s), WithMaxAge(time.Minute), WithClock(clock))
+
+	assert.Equal(t, "bar", c.Password())
+
+	err = s.Set(deviceID.String(), `{"username":"foo","password":"baz"}`)
+	require.NoError(t, err)
+
+	clock.Add(59 * time.Second)
+
+	assert.Equal(t, "bar", c.Password())
+
+	clock.Add(time.Second)
+
+	assert.Equal(t, "baz", c.Password())
+
+	// Update resets the age.
+	err = c.Update("foo", "qux")
+	require.NoError(t, err)
+
+	err = s.Set(deviceID.String(), `{"username":"foo","password":"quux"}`)
+	require.NoError(t, err)
+
+	clock.Add(59 * time.Second)
+
+	assert.Equal(t, "qux", c.Password())
+
+	clock.Add(time.Second)
+
+	err = c.Load(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "quux", c.Password())
+}
+
+func TestCredentials_InvalidateOnAuthFailure(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+
+	c := New(deviceID, WithStorage(s))
+
+	err := c.Update("foo", "bar")
+	require.NoError(t, err)
+
+	err = s.Set(deviceID.String(), `{"username":"foo","password":"baz"}`)
+	require.NoError(t, err)
+
+	assert.False(t, c.InvalidateOnAuthFailure(errors.New("unexpected response")))
+	assert.Equal(t, "bar", c.Password())
+
+	assert.True(t, c.InvalidateOnAuthFailure(ctxd.NewError(context.Background(), "wrong credentials")))
+	assert.Equal(t, "baz", c.Password())
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		error    error
+		expected bool
+	}{
+		{
+			scenario: "nil",
+		},
+		{
+			scenario: "other error",
+			error:    errors.New("too many login attempts"),
+		},
+		{
+			scenario: "missing username",
+			error:    ctxd.WrapError(context.Background(), n26api.ErrUsernameIsEmpty, "could not get token"),
+			expected: true,
+		},
+		{
+			scenario: "missing password",
+			error:    ctxd.WrapError(context.Background(), n26api.ErrPasswordIsEmpty, "could not get token"),
+			expected: true,
+		},
+		{
+			scenario: "wrong credentials",
+			error:    fmt.Errorf("request failed: %w", ctxd.NewError(context.Background(), "wrong credentials")),
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, IsAuthFailure(tc.error))
+		})
+	}
+}
+
+func TestCredentials_Watch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewMemoryStorage()
+
+	c := New(deviceID, WithStorage(s), WithKeyNamespace("staging"))
+
+	type change struct {
+		username string
+		password string
+		err      error
+	}
+
+	changes := make(chan change, 1)
+
+	c.Watch(ctx, func(username, password string, err error) {
+		changes <- change{username: username, password: password, err: err}
+	}, n26keychain.WithPollInterval(time.Hour))
+
+	receive := func() change {
+		select {
+		case ch := <-changes:
+			return ch
+
+		case <-time.After(time.Second):
+			t.Fatal("no change")
+		}
+
+		return change{}
+	}
+
+	// Another process logs in.
+	err := s.Set("staging:"+deviceID.String(), `{"username":"foo","password":"bar"}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, change{username: "foo", password: "bar"}, receive())
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+
+	err = s.Set("staging:"+deviceID.String(), "{")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, receive().err, ErrCorrupted)
+	assert.Empty(t, c.Username())
+
+	err = s.Delete("staging:" + deviceID.String())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, receive().err, ErrNotFound)
+	assert.ErrorIs(t, c.Err(), ErrNotFound)
+}
+
+func TestCredentials_Rollback(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	s := n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0)
+
+	c := New(deviceID, WithStorage(s))
+
+	require.NoError(t, c.Update("foo", "bar"))
+	require.NoError(t, c.Update("foo", "wrong"))
+
+	history, err := c.History()
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	assert.Equal(t, `{"username":"foo","password":"bar"}`, history[0].Value)
+
+	require.NoError(t, c.Rollback(context.Background(), history[0].Version))
+
+	assert.Equal(t, "bar", c.Password())
+
+	err = c.Rollback(context.Background(), 42)
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryVersionNotFound)
+	assert.Equal(t, "bar", c.Password())
+}
+
+func TestCredentials_RollbackNotSupported(t *testing.T) {
+	t.Parallel()
+
+	c := New(uuid.New(), WithStorage(n26keychain.NewMemoryStorage()))
+
+	_, err := c.History()
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+
+	err = c.Rollback(context.Background(), 1)
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+}
+
+func TestCredentials_WithTracing(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	deviceID := uuid.New()
+
+	c := New(deviceID,
+		WithStorage(n26keychain.NewMemoryStorage()),
+		WithServiceNamespace("staging"),
+		WithTracing(n26keychain.WithTracerProvider(tp)),
+	)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+	require.NoError(t, c.UpdateContext(ctx, "foo", "bar"))
+	require.NoError(t, c.Reload(ctx))
+
+	spans := tp.Spans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "keychain.set", spans[0].Name)
+	assert.Equal(t, "keychain.get", spans[1].Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[1].Parent)
+	assert.Equal(t, "n26api.credentials.staging", spans[1].Attributes[n26keychain.AttributeService])
+	assert.Equal(t, n26keychain.HashKey(deviceID.String()), spans[1].Attributes[n26keychain.AttributeKeyHash])
+}
+
+func TestCredentials_MaxAgeReloadError(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	clock := test.NewClock()
+
+	c := New(deviceID, WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil).Once()
+		s.On("Get", deviceID.String()).Return("", keyring.ErrUnsupportedPlatform).Once()
+		s.On("Get", deviceID.String()).Return("", n26keychain.ErrUnavailable).Once()
+		s.On("Get", deviceID.String()).Return("", keyring.ErrNotFound).Once()
+	})(t)), WithMaxAge(time.Minute), WithClock(clock))
+
+	require.NoError(t, c.Load(context.Background()))
+
+	// The previous credentials are kept when they can not be read again.
+	clock.Add(time.Minute)
+
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+	assert.ErrorIs(t, c.Err(), ErrUnavailable)
+
+	clock.Add(time.Minute)
+
+	username, password, err := c.Get(context.Background())
+
+	assert.Equal(t, "foo", username)
+	assert.Equal(t, "bar", password)
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	// They are dropped when they are missing.
+	err = c.Reload(context.Background())
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, c.Username())
+	assert.Empty(t, c.Password())
+}
+
+func TestCredentials_ReloadCorrupted(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil).Once()
+		s.On("Get", deviceID.String()).Return("{", nil).Once()
+	})(t)))
+
+	require.NoError(t, c.Load(context.Background()))
+
+	err := c.Reload(context.Background())
+
+	assert.ErrorIs(t, err, ErrCorrupted)
+	assert.Empty(t, c.Username())
+	assert.Empty(t, c.Password())
+}
+
+func TestCredentials_TransientLoadError(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return("", n26keychain.ErrUnavailable).Once()
+		s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil).Once()
+	})(t)))
+
+	err := c.Load(context.Background())
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	// The failure is not kept.
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+	assert.NoError(t, c.Err())
+}
+
+func TestCredentials_PermanentLoadError(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return("", keyring.ErrUnsupportedPlatform).Once()
+	})(t)))
+
+	err := c.Load(context.Background())
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	// The failure is kept.
+	assert.Empty(t, c.Username())
+	assert.ErrorIs(t, c.Err(), keyring.ErrUnsupportedPlatform)
+}
+
+func TestCredentials_WithRetryStorage(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithStorage(n26keychain.NewRetryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return("", n26keychain.ErrUnavailable).Twice()
+		s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil).Once()
+	})(t), n26keychain.WithRetryBackoff(time.Millisecond, time.Millisecond))))
+
+	username, password, err := c.Get(context.Background())
+
+	assert.Equal(t, "foo", username)
+	assert.Equal(t, "bar", password)
+	assert.NoError(t, err)
+}
+
+func TestCredentials_WithReadOnly(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+
+	c := New(deviceID, WithReadOnly(), WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return(`{"username":"foo","password":"bar"}`, nil).Once()
+	})(t)))
+
+	require.NoError(t, c.Load(context.Background()))
+
+	err := c.Update("baz", "qux")
+
+	assert.ErrorIs(t, err, n26keychain.ErrReadOnly)
+	assert.EqualError(t, err, "could not update credentials: storage is read-only")
+
+	assert.ErrorIs(t, c.Delete(), n26keychain.ErrReadOnly)
+	assert.ErrorIs(t, c.Rollback(context.Background(), 1), n26keychain.ErrReadOnly)
+
+	// The loaded credentials are kept.
+	assert.Equal(t, "foo", c.Username())
+	assert.Equal(t, "bar", c.Password())
+	assert.NoError(t, c.Err())
+}
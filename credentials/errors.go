@@ -0,0 +1,65 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nhatthm/n26api"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+var (
+	// ErrNotFound indicates that there are no credentials in keychain.
+	ErrNotFound = errors.New("credentials not found")
+	// ErrUnavailable indicates that the keychain is not available.
+	ErrUnavailable = errors.New("credentials storage is unavailable")
+	// ErrCorrupted indicates that the credentials in keychain can not be read.
+	ErrCorrupted = errors.New("credentials are corrupted")
+)
+
+// loadError classifies the error of getting the credentials from the storage.
+func loadError(err error) error {
+	switch {
+	case errors.Is(err, keyring.ErrNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+
+	case n26keychain.IsUnavailable(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+
+	case errors.Is(err, n26keychain.ErrNotEncrypted),
+		errors.Is(err, n26keychain.ErrDecryptionFailed),
+		errors.Is(err, n26keychain.ErrChunkCorrupted):
+		return fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+
+	return fmt.Errorf("could not get credentials: %w", err)
+}
+
+// isTransient checks whether the error of getting the credentials may not happen again, so it should not be kept.
+func isTransient(err error) bool {
+	return n26keychain.IsRetryable(err) || isContextError(err)
+}
+
+// isContextError checks whether the call was given up because its context is done. The call may still complete in the
+// keychain afterwards.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsAuthFailure checks whether the error returned by n26api means that the credentials are missing or wrong.
+func IsAuthFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, n26api.ErrUsernameIsEmpty) || errors.Is(err, n26api.ErrPasswordIsEmpty) {
+		return true
+	}
+
+	// n26api does not type the error of a rejected login.
+	return strings.Contains(err.Error(), "wrong credentials")
+}
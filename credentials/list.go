@@ -0,0 +1,35 @@
+package credentials
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+// DeviceIDs returns the ids of the devices that have credentials in the storage. The storage must support listing its
+// keys, see n26keychain.Lister.
+func DeviceIDs(storage n26keychain.Storage) ([]uuid.UUID, error) {
+	keys, err := n26keychain.Keys(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]uuid.UUID, 0, len(keys))
+
+	for _, k := range keys {
+		deviceID, err := uuid.Parse(k)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, deviceID)
+	}
+
+	return result, nil
+}
+
+// DeviceIDs returns the ids of the devices that have credentials in the storage of Credentials. The storage must
+// support listing its keys, see WithIndex.
+func (c *Credentials) DeviceIDs() ([]uuid.UUID, error) {
+	return DeviceIDs(n26keychain.FromStorageContext(c.storage))
+}
@@ -0,0 +1,82 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestDeviceIDs(t *testing.T) {
+	t.Parallel()
+
+	deviceID1 := uuid.MustParse("1b5f4e3c-6d4b-4ae0-a4b9-34d8b3f84c9e")
+	deviceID2 := uuid.MustParse("8d0fa4b3-5b1e-4f7c-9e61-fb0ac2f64a12")
+
+	s := n26keychain.NewIndexedStorage(n26keychain.NewMemoryStorage())
+
+	for _, deviceID := range []uuid.UUID{deviceID2, deviceID1} {
+		err := New(deviceID, WithStorage(s)).Update("foo", "bar")
+		require.NoError(t, err)
+	}
+
+	err := s.Set("not-a-device", "foobar")
+	require.NoError(t, err)
+
+	result, err := DeviceIDs(s)
+
+	assert.Equal(t, []uuid.UUID{deviceID1, deviceID2}, result)
+	assert.NoError(t, err)
+
+	// Clean up.
+	err = New(deviceID1, WithStorage(s)).Delete()
+	require.NoError(t, err)
+
+	result, err = DeviceIDs(s)
+
+	assert.Equal(t, []uuid.UUID{deviceID2}, result)
+	assert.NoError(t, err)
+}
+
+func TestDeviceIDs_NotSupported(t *testing.T) {
+	t.Parallel()
+
+	result, err := DeviceIDs(mock.NoMockStorage(t))
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, n26keychain.ErrListNotSupported)
+}
+
+func TestCredentials_DeviceIDsWithIndex(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.MustParse("1b5f4e3c-6d4b-4ae0-a4b9-34d8b3f84c9e")
+
+	// The storage can not list its keys.
+	s := struct{ n26keychain.Storage }{n26keychain.NewMemoryStorage()}
+
+	_, err := New(deviceID, WithStorage(s)).DeviceIDs()
+	require.ErrorIs(t, err, n26keychain.ErrListNotSupported)
+
+	c := New(deviceID, WithStorage(s), WithIndex(), WithKeyNamespace("staging"))
+
+	err = c.Update("foo", "bar")
+	require.NoError(t, err)
+
+	result, err := c.DeviceIDs()
+
+	assert.Equal(t, []uuid.UUID{deviceID}, result)
+	assert.NoError(t, err)
+
+	err = c.Delete()
+	require.NoError(t, err)
+
+	result, err = c.DeviceIDs()
+
+	assert.Empty(t, result)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,120 @@
+package credentials
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+// Operations of the spans of the credentials.
+const (
+	TracingOperationUsername = "username"
+	TracingOperationPassword = "password"
+	TracingOperationUpdate   = "update"
+	TracingOperationDelete   = "delete"
+)
+
+var (
+	_ KeychainCredentials         = (*tracingCredentials)(nil)
+	_ KeychainCredentialsProvider = (*tracingCredentials)(nil)
+)
+
+// contextCredentials are the credentials that can pass the context of the span to their storage, like Credentials.
+type contextCredentials interface {
+	Get(ctx context.Context) (string, string, error)
+	UpdateContext(ctx context.Context, username, password string) error
+	DeleteContext(ctx context.Context) error
+}
+
+type tracingCredentials struct {
+	credentials KeychainCredentials
+	key         string
+	tracer      *n26keychain.Tracer
+}
+
+// get returns the username and the password from the underlying credentials, within the span of the context.
+func (c *tracingCredentials) get(ctx context.Context) (string, string, error) {
+	if cc, ok := c.credentials.(contextCredentials); ok {
+		return cc.Get(ctx)
+	}
+
+	return c.credentials.Username(), c.credentials.Password(), nil
+}
+
+// Username returns the username from the underlying credentials in a span.
+func (c *tracingCredentials) Username() string {
+	ctx, end := c.tracer.Start(context.Background(), TracingOperationUsername, c.key)
+	username, _, err := c.get(ctx)
+
+	end(err)
+
+	return username
+}
+
+// Password returns the password from the underlying credentials in a span.
+func (c *tracingCredentials) Password() string {
+	ctx, end := c.tracer.Start(context.Background(), TracingOperationPassword, c.key)
+	_, password, err := c.get(ctx)
+
+	end(err)
+
+	return password
+}
+
+// Update persists new credentials with the underlying credentials in a span.
+func (c *tracingCredentials) Update(username, password string) error {
+	ctx, end := c.tracer.Start(context.Background(), TracingOperationUpdate, c.key)
+
+	var err error
+
+	if cc, ok := c.credentials.(contextCredentials); ok {
+		err = cc.UpdateContext(ctx, username, password)
+	} else {
+		err = c.credentials.Update(username, password)
+	}
+
+	end(err)
+
+	return err
+}
+
+// Delete deletes the credentials with the underlying credentials in a span.
+func (c *tracingCredentials) Delete() error {
+	ctx, end := c.tracer.Start(context.Background(), TracingOperationDelete, c.key)
+
+	var err error
+
+	if cc, ok := c.credentials.(contextCredentials); ok {
+		err = cc.DeleteContext(ctx)
+	} else {
+		err = c.credentials.Delete()
+	}
+
+	end(err)
+
+	return err
+}
+
+// KeychainCredentials provides KeychainCredentials.
+func (c *tracingCredentials) KeychainCredentials() KeychainCredentials {
+	return c
+}
+
+// NewTracingCredentials creates credentials that record every call of the n26 client in an OpenTelemetry span, even
+// when the credentials are already loaded, with the operation, the service, the hash of the device ID and the error
+// class. When the underlying credentials are Credentials, the spans of their storage, see WithTracing, are children of
+// these spans, so a call that loads the credentials from keychain can be told from a call that is served from memory.
+func NewTracingCredentials(
+	credentials KeychainCredentials,
+	deviceID uuid.UUID,
+	service string,
+	options ...n26keychain.TracingOption,
+) KeychainCredentials {
+	return &tracingCredentials{
+		credentials: credentials,
+		key:         deviceID.String(),
+		tracer:      n26keychain.NewTracer(service, options...),
+	}
+}
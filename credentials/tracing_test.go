@@ -0,0 +1,94 @@
+//go:build !integration
+
+package credentials
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestTracingCredentials(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	deviceID := uuid.New()
+	memory := n26keychain.NewMemoryStorage()
+
+	require.NoError(t, memory.Set(deviceID.String(), `{"username":"foo","password":"bar"}`))
+
+	c := newProvider(deviceID,
+		WithStorage(memory),
+		WithServiceNamespace("staging"),
+		WithTracing(n26keychain.WithTracerProvider(tp)),
+	)
+
+	assert.Equal(t, c, c.(KeychainCredentialsProvider).KeychainCredentials())
+
+	// The credentials are loaded.
+	assert.Equal(t, "foo", c.Username())
+
+	// The credentials are read from memory.
+	assert.Equal(t, "bar", c.Password())
+
+	require.NoError(t, c.Update("baz", "qux"))
+	require.NoError(t, c.Delete())
+
+	spans := tp.Spans()
+	require.Len(t, spans, 7)
+
+	assert.Equal(t, "keychain.get", spans[0].Name)
+	assert.Equal(t, spans[1].ID, spans[0].Parent)
+	assert.Equal(t, "keychain.username", spans[1].Name)
+	assert.Equal(t, "n26api.credentials.staging", spans[1].Attributes[n26keychain.AttributeService])
+	assert.Equal(t, n26keychain.HashKey(deviceID.String()), spans[1].Attributes[n26keychain.AttributeKeyHash])
+	assert.Equal(t, "keychain.password", spans[2].Name)
+	assert.Equal(t, "keychain.set", spans[3].Name)
+	assert.Equal(t, spans[4].ID, spans[3].Parent)
+	assert.Equal(t, "keychain.update", spans[4].Name)
+	assert.Equal(t, spans[6].ID, spans[5].Parent)
+	assert.Equal(t, "keychain.delete", spans[6].Name)
+	assert.Equal(t, TracingOperationDelete, spans[6].Attributes[n26keychain.AttributeOperation])
+}
+
+func TestTracingCredentials_Error(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	deviceID := uuid.New()
+
+	c := NewTracingCredentials(New(deviceID, WithStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", deviceID.String()).Return("", n26keychain.ErrUnavailable).Once()
+		s.On("Get", deviceID.String()).Return("", keyring.ErrNotFound).Once()
+	})(t))), deviceID, "n26api.credentials", n26keychain.WithTracerProvider(tp))
+
+	assert.Empty(t, c.Username())
+	assert.Empty(t, c.Password())
+
+	spans := tp.Spans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "keychain.username", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status)
+	assert.Equal(t, "unavailable", spans[0].Attributes[n26keychain.AttributeErrorClass])
+
+	// A missing entry is not an error of the span.
+	assert.Equal(t, "keychain.password", spans[1].Name)
+	assert.Equal(t, codes.Unset, spans[1].Status)
+	assert.Equal(t, "not_found", spans[1].Attributes[n26keychain.AttributeErrorClass])
+}
+
+func TestWithCredentialsProvider_Tracing(t *testing.T) {
+	t.Parallel()
+
+	assert.IsType(t, &tracingCredentials{}, newProvider(uuid.New(), WithTracing()))
+	assert.IsType(t, &Credentials{}, newProvider(uuid.New()))
+}
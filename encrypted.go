@@ -0,0 +1,347 @@
+package n26keychain
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	envelopeVersion = 1
+	envelopePrefix  = "n26keychain:enc:v1:"
+	dataKeySize     = 32
+)
+
+var (
+	// ErrNotEncrypted indicates that the stored value is not an encrypted envelope.
+	ErrNotEncrypted = errors.New("value is not encrypted")
+	// ErrDecryptionFailed indicates that the stored value could not be decrypted.
+	ErrDecryptionFailed = errors.New("could not decrypt value")
+	// ErrUnknownMasterKey indicates that the key provider does not have the requested master key.
+	ErrUnknownMasterKey = errors.New("unknown master key")
+)
+
+var (
+	_ Storage        = (*encryptedStorage)(nil)
+	_ StorageContext = (*encryptedStorage)(nil)
+	_ Lister         = (*encryptedStorage)(nil)
+	_ Notifier       = (*encryptedStorage)(nil)
+	_ Versioned      = (*encryptedStorage)(nil)
+	_ HistoryKeeper  = (*encryptedStorage)(nil)
+	_ KeyProvider    = (*StaticKeyProvider)(nil)
+)
+
+// KeyProvider provides master keys for protecting the data keys of the encrypted storage. The master keys must be
+// 16, 24 or 32 bytes long.
+type KeyProvider interface {
+	// CurrentKey returns the id and the value of the master key that is used for encrypting new values.
+	CurrentKey() (string, []byte, error)
+	// Key returns the master key of the given id.
+	Key(id string) ([]byte, error)
+}
+
+// EncryptedStorageOption configures the encrypted storage.
+type EncryptedStorageOption func(s *encryptedStorage)
+
+type envelope struct {
+	Version      int    `json:"v"`
+	KeyID        string `json:"kid"`
+	DataKeyNonce []byte `json:"dkn"`
+	DataKey      []byte `json:"dk"`
+	Nonce        []byte `json:"n"`
+	Data         []byte `json:"d"`
+}
+
+type encryptedStorage struct {
+	storage StorageContext
+	keys    KeyProvider
+
+	plaintextFallback bool
+}
+
+// Set encrypts the password and sets it in the underlying storage.
+func (s *encryptedStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext encrypts the password and sets it in the underlying storage.
+func (s *encryptedStorage) SetContext(ctx context.Context, user, password string) error {
+	data, err := s.encrypt(user, password)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.SetContext(ctx, user, data)
+}
+
+// Get gets password from the underlying storage and decrypts it.
+func (s *encryptedStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage and decrypts it.
+func (s *encryptedStorage) GetContext(ctx context.Context, user string) (string, error) {
+	data, err := s.storage.GetContext(ctx, user)
+	if err != nil {
+		return "", err
+	}
+
+	return s.decrypt(user, data)
+}
+
+// Delete deletes secret from the underlying storage.
+func (s *encryptedStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage.
+func (s *encryptedStorage) DeleteContext(ctx context.Context, user string) error {
+	return s.storage.DeleteContext(ctx, user)
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *encryptedStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *encryptedStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version from the underlying storage, if it supports versions, and decrypts it.
+func (s *encryptedStorage) GetVersion(user string) (string, string, error) {
+	data, version, err := GetVersion(FromStorageContext(s.storage), user)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err := s.decrypt(user, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return password, version, nil
+}
+
+// SetIfMatch encrypts the password and sets it only if the current version is the expected one, if the underlying
+// storage supports versions.
+func (s *encryptedStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	data, err := s.encrypt(user, password)
+	if err != nil {
+		return "", err
+	}
+
+	return SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, data)
+}
+
+// History returns the decrypted versions of the key, if the underlying storage keeps them.
+func (s *encryptedStorage) History(user string) ([]HistoryEntry, error) {
+	entries, err := History(FromStorageContext(s.storage), user)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]HistoryEntry, len(entries))
+
+	for i, e := range entries {
+		if e.Value, err = s.decrypt(user, e.Value); err != nil {
+			return nil, fmt.Errorf("could not decrypt version %d: %w", e.Version, err)
+		}
+
+		result[i] = e
+	}
+
+	return result, nil
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history. The value is
+// restored as it was encrypted.
+func (s *encryptedStorage) Rollback(user string, version int) error {
+	return Rollback(FromStorageContext(s.storage), user, version)
+}
+
+func (s *encryptedStorage) encrypt(user, password string) (string, error) {
+	keyID, masterKey, err := s.keys.CurrentKey()
+	if err != nil {
+		return "", fmt.Errorf("could not get master key: %w", err)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("could not generate data key: %w", err)
+	}
+
+	e := envelope{Version: envelopeVersion, KeyID: keyID}
+
+	if e.DataKeyNonce, e.DataKey, err = seal(masterKey, dataKey, []byte(keyID)); err != nil {
+		return "", err
+	}
+
+	if e.Nonce, e.Data, err = seal(dataKey, []byte(password), envelopeAAD(user)); err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + base64.RawStdEncoding.EncodeToString(raw), nil
+}
+
+func (s *encryptedStorage) decrypt(user, data string) (string, error) {
+	if !strings.HasPrefix(data, envelopePrefix) {
+		if s.plaintextFallback {
+			return data, nil
+		}
+
+		return "", ErrNotEncrypted
+	}
+
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(data, envelopePrefix))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrDecryptionFailed, err.Error())
+	}
+
+	var e envelope
+
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrDecryptionFailed, err.Error())
+	}
+
+	if e.Version != envelopeVersion {
+		return "", fmt.Errorf("%w: unsupported version %d", ErrDecryptionFailed, e.Version)
+	}
+
+	masterKey, err := s.keys.Key(e.KeyID)
+	if err != nil {
+		return "", fmt.Errorf("could not get master key: %w", err)
+	}
+
+	dataKey, err := open(masterKey, e.DataKeyNonce, e.DataKey, []byte(e.KeyID))
+	if err != nil {
+		return "", err
+	}
+
+	password, err := open(dataKey, e.Nonce, e.Data, envelopeAAD(user))
+	if err != nil {
+		return "", err
+	}
+
+	return string(password), nil
+}
+
+// envelopeAAD binds the encrypted value to its key, so it can not be moved to another entry.
+func envelopeAAD(user string) []byte {
+	return []byte(envelopePrefix + user)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, []byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func open(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+// NewEncryptedStorage creates a storage that encrypts the values before writing them to the underlying storage. Each
+// value is encrypted with its own data key, which is protected by a master key from the key provider.
+func NewEncryptedStorage(storage Storage, keys KeyProvider, options ...EncryptedStorageOption) Storage {
+	s := &encryptedStorage{
+		storage: ToStorageContext(storage),
+		keys:    keys,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithPlaintextFallback returns the stored values that are not encrypted as is, instead of failing with
+// ErrNotEncrypted. It helps migrating existing entries, which are encrypted on the next write.
+func WithPlaintextFallback() EncryptedStorageOption {
+	return func(s *encryptedStorage) {
+		s.plaintextFallback = true
+	}
+}
+
+// StaticKeyProvider provides master keys from memory.
+type StaticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// CurrentKey returns the id and the value of the master key that is used for encrypting new values.
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+// Key returns the master key of the given id.
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMasterKey, id)
+	}
+
+	return key, nil
+}
+
+// WithKey adds a master key that is only used for decrypting, for example after a key rotation.
+func (p *StaticKeyProvider) WithKey(id string, key []byte) *StaticKeyProvider {
+	p.keys[id] = key
+
+	return p
+}
+
+// NewStaticKeyProvider creates a key provider with the master key that is used for encrypting new values.
+func NewStaticKeyProvider(id string, key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{
+		current: id,
+		keys:    map[string][]byte{id: key},
+	}
+}
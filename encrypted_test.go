@@ -0,0 +1,297 @@
+package n26keychain_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+var (
+	masterKey1 = []byte("0123456789abcdef0123456789abcdef")
+	masterKey2 = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key1", masterKey1))
+
+	// Get not found.
+	_, err := s.Get("test")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Set.
+	err = s.Set("test", `{"username":"foo","password":"bar"}`)
+	require.NoError(t, err)
+
+	stored, err := memory.Get("test")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(stored, "n26keychain:enc:v1:"))
+	assert.NotContains(t, stored, "bar")
+
+	data, err := s.Get("test")
+
+	assert.Equal(t, `{"username":"foo","password":"bar"}`, data)
+	assert.NoError(t, err)
+
+	// Delete.
+	err = s.Delete("test")
+	require.NoError(t, err)
+
+	_, err = memory.Get("test")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestEncryptedStorage_KeyRotation(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+
+	err := n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key1", masterKey1)).
+		Set("test", "foobar")
+	require.NoError(t, err)
+
+	// The old key is still known.
+	keys := n26keychain.NewStaticKeyProvider("key2", masterKey2).WithKey("key1", masterKey1)
+
+	data, err := n26keychain.NewEncryptedStorage(memory, keys).Get("test")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+
+	// The old key is gone.
+	_, err = n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key2", masterKey2)).Get("test")
+
+	assert.ErrorIs(t, err, n26keychain.ErrUnknownMasterKey)
+}
+
+func TestEncryptedStorage_WrongKey(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+
+	err := n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key", masterKey1)).
+		Set("test", "foobar")
+	require.NoError(t, err)
+
+	_, err = n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key", masterKey2)).Get("test")
+
+	assert.ErrorIs(t, err, n26keychain.ErrDecryptionFailed)
+}
+
+func TestEncryptedStorage_MovedValue(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key", masterKey1))
+
+	err := s.Set("test", "foobar")
+	require.NoError(t, err)
+
+	stored, err := memory.Get("test")
+	require.NoError(t, err)
+
+	err = memory.Set("other", stored)
+	require.NoError(t, err)
+
+	_, err = s.Get("other")
+
+	assert.ErrorIs(t, err, n26keychain.ErrDecryptionFailed)
+}
+
+func TestEncryptedStorage_GetInvalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		stored        string
+		options       []n26keychain.EncryptedStorageOption
+		expectedData  string
+		expectedError error
+	}{
+		{
+			scenario:      "not encrypted",
+			stored:        "foobar",
+			expectedError: n26keychain.ErrNotEncrypted,
+		},
+		{
+			scenario:     "plaintext fallback",
+			stored:       "foobar",
+			options:      []n26keychain.EncryptedStorageOption{n26keychain.WithPlaintextFallback()},
+			expectedData: "foobar",
+		},
+		{
+			scenario:      "not base64",
+			stored:        "n26keychain:enc:v1:!",
+			expectedError: n26keychain.ErrDecryptionFailed,
+		},
+		{
+			scenario:      "not json",
+			stored:        "n26keychain:enc:v1:ew",
+			expectedError: n26keychain.ErrDecryptionFailed,
+		},
+		{
+			scenario:      "unknown version",
+			stored:        "n26keychain:enc:v1:eyJ2Ijo0Mn0",
+			expectedError: n26keychain.ErrDecryptionFailed,
+		},
+		{
+			scenario:      "missing nonce",
+			stored:        "n26keychain:enc:v1:eyJ2IjoxLCJraWQiOiJrZXkifQ",
+			expectedError: n26keychain.ErrDecryptionFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			memory := n26keychain.NewMemoryStorage()
+
+			err := memory.Set("test", tc.stored)
+			require.NoError(t, err)
+
+			s := n26keychain.NewEncryptedStorage(memory, n26keychain.NewStaticKeyProvider("key", masterKey1), tc.options...)
+
+			data, err := s.Get("test")
+
+			assert.Equal(t, tc.expectedData, data)
+
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestEncryptedStorage_SetError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		mockStorage   mock.StorageMocker
+		keys          n26keychain.KeyProvider
+		expectedError string
+	}{
+		{
+			scenario:      "invalid master key",
+			mockStorage:   mock.NoMockStorage,
+			keys:          n26keychain.NewStaticKeyProvider("key", []byte("short")),
+			expectedError: "crypto/aes: invalid key size 5",
+		},
+		{
+			scenario:      "key provider error",
+			mockStorage:   mock.NoMockStorage,
+			keys:          failingKeyProvider{},
+			expectedError: "could not get master key: key error",
+		},
+		{
+			scenario: "storage error",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "test", testifyMock.Anything).Return(errors.New("set error"))
+			}),
+			keys:          n26keychain.NewStaticKeyProvider("key", masterKey1),
+			expectedError: "set error",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			err := n26keychain.NewEncryptedStorage(tc.mockStorage(t), tc.keys).Set("test", "foobar")
+
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestEncryptedStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewEncryptedStorage(n26keychain.NewVersionedStorage(memory), n26keychain.NewStaticKeyProvider("key1", masterKey1))
+
+	require.NoError(t, s.Set("test", "foo"))
+
+	password, version, err := n26keychain.GetVersion(s, "test")
+	require.NoError(t, err)
+
+	assert.Equal(t, "foo", password)
+
+	_, err = n26keychain.SetIfMatch(s, "test", version, "bar")
+	require.NoError(t, err)
+
+	_, err = n26keychain.SetIfMatch(s, "test", version, "baz")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	stored, err := memory.Get("test")
+	require.NoError(t, err)
+
+	assert.NotContains(t, stored, "bar")
+
+	data, err := s.Get("test")
+
+	assert.Equal(t, "bar", data)
+	assert.NoError(t, err)
+}
+
+func TestEncryptedStorage_History(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewEncryptedStorage(n26keychain.NewHistoryStorage(memory, 0), n26keychain.NewStaticKeyProvider("key1", masterKey1))
+
+	require.NoError(t, s.Set("test", "foo"))
+	require.NoError(t, s.Set("test", "bar"))
+
+	history, err := n26keychain.History(s, "test")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	assert.Equal(t, "foo", history[0].Value)
+	assert.Equal(t, "bar", history[1].Value)
+
+	stored, err := memory.Get("test#history")
+	require.NoError(t, err)
+
+	assert.NotContains(t, stored, "foo")
+
+	require.NoError(t, n26keychain.Rollback(s, "test", history[0].Version))
+
+	data, err := s.Get("test")
+
+	assert.Equal(t, "foo", data)
+	assert.NoError(t, err)
+
+	// A version that can not be decrypted.
+	_, err = n26keychain.History(n26keychain.NewEncryptedStorage(n26keychain.NewHistoryStorage(memory, 0), n26keychain.NewStaticKeyProvider("key2", masterKey2)), "test")
+
+	assert.ErrorIs(t, err, n26keychain.ErrUnknownMasterKey)
+}
+
+type failingKeyProvider struct{}
+
+func (failingKeyProvider) CurrentKey() (string, []byte, error) {
+	return "", nil, errors.New("key error")
+}
+
+func (failingKeyProvider) Key(string) ([]byte, error) {
+	return nil, errors.New("key error")
+}
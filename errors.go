@@ -0,0 +1,53 @@
+package n26keychain
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/zalando/go-keyring"
+)
+
+// ErrUnavailable indicates that the storage backend is not available.
+var ErrUnavailable = errors.New("storage is unavailable")
+
+// IsUnavailable checks whether the error means that the storage backend is not available, for example there is no
+// D-Bus Secret Service on Linux, the platform is not supported by go-keyring, the security tool is missing on macOS or
+// the circuit breaker is open, see ErrCircuitOpen.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrUnavailable) || errors.Is(err, keyring.ErrUnsupportedPlatform) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	var (
+		dbusErr dbus.Error
+		execErr *exec.Error
+		netErr  *net.OpError
+	)
+
+	if errors.As(err, &dbusErr) || errors.As(err, &execErr) || errors.As(err, &netErr) {
+		return true
+	}
+
+	// The errors of the D-Bus connection are not typed.
+	return strings.HasPrefix(err.Error(), "dbus: ")
+}
+
+// IsRetryable checks whether the error of the storage backend is transient, so the operation may succeed if it is tried
+// again, for example the D-Bus Secret Service is not started or unlocked yet right after login, or the circuit breaker
+// is open. An unsupported platform or a missing security tool is not transient.
+func IsRetryable(err error) bool {
+	var execErr *exec.Error
+
+	if errors.Is(err, keyring.ErrUnsupportedPlatform) || errors.As(err, &execErr) {
+		return false
+	}
+
+	return IsUnavailable(err)
+}
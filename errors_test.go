@@ -0,0 +1,144 @@
+package n26keychain_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+func TestIsUnavailable(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		error    error
+		expected bool
+	}{
+		{
+			scenario: "nil",
+		},
+		{
+			scenario: "not found",
+			error:    keyring.ErrNotFound,
+		},
+		{
+			scenario: "data too big",
+			error:    keyring.ErrSetDataTooBig,
+		},
+		{
+			scenario: "unknown error",
+			error:    errors.New("unknown"),
+		},
+		{
+			scenario: "unavailable",
+			error:    fmt.Errorf("wrapped: %w", n26keychain.ErrUnavailable),
+			expected: true,
+		},
+		{
+			scenario: "unsupported platform",
+			error:    keyring.ErrUnsupportedPlatform,
+			expected: true,
+		},
+		{
+			scenario: "dbus error",
+			error:    dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"},
+			expected: true,
+		},
+		{
+			scenario: "dbus connection error",
+			error:    errors.New("dbus: couldn't determine address of session bus"),
+			expected: true,
+		},
+		{
+			scenario: "exec error",
+			error:    &exec.Error{Name: "/usr/bin/security", Err: exec.ErrNotFound},
+			expected: true,
+		},
+		{
+			scenario: "circuit open",
+			error:    fmt.Errorf("wrapped: %w", n26keychain.ErrCircuitOpen),
+			expected: true,
+		},
+		{
+			scenario: "net error",
+			error:    &net.OpError{Op: "dial", Net: "unix", Err: errors.New("connection refused")},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, n26keychain.IsUnavailable(tc.error))
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		error    error
+		expected bool
+	}{
+		{
+			scenario: "nil",
+		},
+		{
+			scenario: "not found",
+			error:    keyring.ErrNotFound,
+		},
+		{
+			scenario: "unknown error",
+			error:    errors.New("unknown"),
+		},
+		{
+			scenario: "unsupported platform",
+			error:    keyring.ErrUnsupportedPlatform,
+		},
+		{
+			scenario: "exec error",
+			error:    &exec.Error{Name: "/usr/bin/security", Err: exec.ErrNotFound},
+		},
+		{
+			scenario: "unavailable",
+			error:    fmt.Errorf("wrapped: %w", n26keychain.ErrUnavailable),
+			expected: true,
+		},
+		{
+			scenario: "circuit open",
+			error:    n26keychain.ErrCircuitOpen,
+			expected: true,
+		},
+		{
+			scenario: "dbus error",
+			error:    dbus.Error{Name: "org.freedesktop.Secret.Error.IsLocked"},
+			expected: true,
+		},
+		{
+			scenario: "dbus connection error",
+			error:    errors.New("dbus: couldn't determine address of session bus"),
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, n26keychain.IsRetryable(tc.error))
+		})
+	}
+}
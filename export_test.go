@@ -0,0 +1,11 @@
+package n26keychain
+
+// TimeoutWrites returns the number of keys of the timeout storage whose writes are ordered.
+func TimeoutWrites(s Storage) int {
+	ts := s.(*timeoutStorage) //nolint: errcheck,forcetypeassert
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return len(ts.writes)
+}
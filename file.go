@@ -0,0 +1,424 @@
+package n26keychain
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileVersion = 1
+	fileKDF     = "scrypt"
+	fileMode    = 0o600
+	fileDirMode = 0o700
+	fileKeySize = 32
+	fileSaltLen = 16
+
+	fileLockSuffix = ".lock"
+
+	// fileScryptMaxMemory and fileScryptMaxP bound the cost of the key derivation of a file, so a crafted file can not
+	// exhaust the memory or the CPU. scrypt uses 128 * N * r bytes of memory.
+	fileScryptMaxMemory = 1 << 30
+	fileScryptMaxP      = 16
+)
+
+var (
+	// ErrFileDecryptionFailed indicates that the storage file could not be decrypted, either because the passphrase
+	// is wrong or because the file has been tampered with.
+	ErrFileDecryptionFailed = errors.New("could not decrypt storage file")
+	// ErrFileUnsupported indicates that the storage file was written in a format that is not supported.
+	ErrFileUnsupported = errors.New("unsupported storage file")
+	// ErrInvalidScryptParams indicates that the scrypt parameters of the file storage, see WithScryptParams, are not
+	// valid or not within the bounds.
+	ErrInvalidScryptParams = errors.New("invalid scrypt parameters")
+)
+
+var (
+	_ Storage  = (*fileStorage)(nil)
+	_ Lister   = (*fileStorage)(nil)
+	_ Notifier = (*fileStorage)(nil)
+)
+
+// FileStorageOption configures the file storage.
+type FileStorageOption func(s *fileStorage)
+
+type fileKDFParams struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+type fileHeader struct {
+	Version int           `json:"version"`
+	KDF     fileKDFParams `json:"kdf"`
+}
+
+type fileContent struct {
+	fileHeader
+
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+type fileStorage struct {
+	path       string
+	passphrase []byte
+	n, r, p    int
+
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+
+	// kdf and key cache the last derived key, so we do not run the key derivation on every call.
+	kdf fileKDFParams
+	key []byte
+}
+
+// Set sets password in the storage file for user.
+func (s *fileStorage) Set(user, password string) error {
+	return s.update(func(entries map[string]string) error {
+		entries[user] = password
+
+		return nil
+	})
+}
+
+// Get gets password from the storage file.
+func (s *fileStorage) Get(user string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	password, ok := entries[user]
+	if !ok {
+		return "", keyring.ErrNotFound
+	}
+
+	return password, nil
+}
+
+// Delete deletes secret from the storage file.
+func (s *fileStorage) Delete(user string) error {
+	return s.update(func(entries map[string]string) error {
+		if _, ok := entries[user]; !ok {
+			return keyring.ErrNotFound
+		}
+
+		delete(entries, user)
+
+		return nil
+	})
+}
+
+// Keys returns all the keys in the storage file.
+func (s *fileStorage) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(entries), nil
+}
+
+// update changes the entries of the storage file. The file is locked from the read to the write, so the storages of
+// other processes that share the file do not lose the change.
+func (s *fileStorage) update(fn func(entries map[string]string) error) (err error) {
+	// The file could not be read afterwards.
+	if kdf := (fileKDFParams{N: s.n, R: s.r, P: s.p}); !validKDFParams(kdf) {
+		return fmt.Errorf("%w: n=%d, r=%d, p=%d", ErrInvalidScryptParams, kdf.N, kdf.R, kdf.P)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), fileDirMode); err != nil {
+		return fmt.Errorf("could not create storage directory: %w", err)
+	}
+
+	unlock, err := lockFile(s.path + fileLockSuffix)
+	if err != nil {
+		return fmt.Errorf("could not lock storage file: %w", err)
+	}
+
+	defer func() {
+		if unlockErr := unlock(); err == nil && unlockErr != nil {
+			err = fmt.Errorf("could not unlock storage file: %w", unlockErr)
+		}
+	}()
+
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(entries); err != nil {
+		return err
+	}
+
+	if err := s.write(entries); err != nil {
+		return err
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// Notify returns a channel that receives a value when the entries are changed by this storage. The changes of the other
+// processes that share the storage file are not notified. The channel is closed when the context is done.
+func (s *fileStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subscribers, ch)
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// notify notifies the subscribers without blocking. The caller must hold the lock.
+func (s *fileStorage) notify() {
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *fileStorage) read() (map[string]string, error) {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[string]string), nil
+		}
+
+		return nil, fmt.Errorf("could not read storage file: %w", err)
+	}
+
+	var content fileContent
+
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileUnsupported, err.Error())
+	}
+
+	if content.Version != fileVersion || content.KDF.Name != fileKDF {
+		return nil, fmt.Errorf("%w: version %d, kdf %q", ErrFileUnsupported, content.Version, content.KDF.Name)
+	}
+
+	if !validKDFParams(content.KDF) {
+		return nil, fmt.Errorf("%w: scrypt parameters n=%d, r=%d, p=%d", ErrFileUnsupported,
+			content.KDF.N, content.KDF.R, content.KDF.P)
+	}
+
+	aead, err := s.cipher(content.KDF)
+	if err != nil {
+		return nil, err
+	}
+
+	aad, err := json.Marshal(content.fileHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content.Nonce) != aead.NonceSize() {
+		return nil, ErrFileDecryptionFailed
+	}
+
+	data, err := aead.Open(nil, content.Nonce, content.Data, aad)
+	if err != nil {
+		return nil, ErrFileDecryptionFailed
+	}
+
+	entries := make(map[string]string)
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileUnsupported, err.Error())
+	}
+
+	return entries, nil
+}
+
+func (s *fileStorage) write(entries map[string]string) error {
+	kdf := s.kdf
+
+	// The salt is kept for the lifetime of the file, a fresh nonce is used for every write.
+	if kdf.Salt == nil || kdf.N != s.n || kdf.R != s.r || kdf.P != s.p {
+		kdf = fileKDFParams{Name: fileKDF, Salt: make([]byte, fileSaltLen), N: s.n, R: s.r, P: s.p}
+
+		if _, err := io.ReadFull(rand.Reader, kdf.Salt); err != nil {
+			return fmt.Errorf("could not generate salt: %w", err)
+		}
+	}
+
+	aead, err := s.cipher(kdf)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	content := fileContent{
+		fileHeader: fileHeader{Version: fileVersion, KDF: kdf},
+		Nonce:      make([]byte, aead.NonceSize()),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, content.Nonce); err != nil {
+		return fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	aad, err := json.Marshal(content.fileHeader)
+	if err != nil {
+		return err
+	}
+
+	content.Data = aead.Seal(nil, content.Nonce, data, aad)
+
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, raw)
+}
+
+func (s *fileStorage) cipher(kdf fileKDFParams) (cipher.AEAD, error) {
+	if s.key == nil || !sameKDFParams(s.kdf, kdf) {
+		key, err := scrypt.Key(s.passphrase, kdf.Salt, kdf.N, kdf.R, kdf.P, fileKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("could not derive key: %w", err)
+		}
+
+		s.kdf = kdf
+		s.key = key
+	}
+
+	return newGCM(s.key)
+}
+
+// validKDFParams checks that the scrypt parameters of a file are valid and within the bounds.
+func validKDFParams(kdf fileKDFParams) bool {
+	switch {
+	case kdf.N <= 1, kdf.N&(kdf.N-1) != 0, kdf.R <= 0, kdf.P <= 0, kdf.P > fileScryptMaxP:
+		return false
+
+	case kdf.R > fileScryptMaxMemory/128, kdf.N > fileScryptMaxMemory/(128*kdf.R):
+		return false
+	}
+
+	return true
+}
+
+func sameKDFParams(a, b fileKDFParams) bool {
+	return a.Name == b.Name && a.N == b.N && a.R == b.R && a.P == b.P && string(a.Salt) == string(b.Salt)
+}
+
+// writeFileAtomic writes data to a temporary file next to the destination and then renames it, so readers never see
+// a partially written file.
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, fileDirMode); err != nil {
+		return fmt.Errorf("could not create storage directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create storage file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = f.Close()           //nolint: errcheck
+			_ = os.Remove(f.Name()) //nolint: errcheck
+		}
+	}()
+
+	if err := f.Chmod(fileMode); err != nil {
+		return fmt.Errorf("could not change storage file mode: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("could not write storage file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("could not write storage file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write storage file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not replace storage file: %w", err)
+	}
+
+	return nil
+}
+
+// NewFileStorage creates a storage that persists all the entries of a service in a single file at the given path.
+// The content is encrypted with AES-256-GCM using a key derived from the passphrase with scrypt.
+//
+// The writes lock a file next to the storage file, with the ".lock" suffix, so several processes can share the
+// storage file. The lock uses flock, on the platforms without it only the writes of the same storage are serialized.
+// The storage notifies about its own writes, see Notifier, and the changes of the other processes are polled by Watch.
+func NewFileStorage(path, passphrase string, options ...FileStorageOption) Storage {
+	s := &fileStorage{
+		path:       path,
+		passphrase: []byte(passphrase),
+		n:          32768,
+		r:          8,
+		p:          1,
+
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithScryptParams sets the scrypt cost parameters used for deriving the key of new storage files. n must be a power of
+// two, the key derivation can not need more than 1 GiB of memory, 128 * n * r bytes, and p can not be above 16.
+// Otherwise, the writes fail with ErrInvalidScryptParams and the file is not changed.
+func WithScryptParams(n, r, p int) FileStorageOption {
+	return func(s *fileStorage) {
+		s.n = n
+		s.r = r
+		s.p = p
+	}
+}
@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package n26keychain
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile locks the lock file with flock, waiting until it is free. Closing the file, or the end of the process,
+// releases the lock.
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, fileMode) //nolint: gosec
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close() //nolint: errcheck
+
+		return nil, err
+	}
+
+	return f.Close, nil
+}
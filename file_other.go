@@ -0,0 +1,8 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package n26keychain
+
+// lockFile does not lock, flock is not supported. Only the writes of the same storage are serialized.
+func lockFile(string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,243 @@
+package n26keychain_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+func newFileStorage(path, passphrase string) n26keychain.Storage {
+	return n26keychain.NewFileStorage(path, passphrase, n26keychain.WithScryptParams(1024, 8, 1))
+}
+
+func TestFileStorage(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keychain", "storage.json")
+	s := newFileStorage(path, "secret")
+
+	// Get not found.
+	data, err := s.Get("test")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Set.
+	err = s.Set("test", "foobar")
+	require.NoError(t, err)
+
+	data, err = s.Get("test")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+
+	// Delete.
+	err = s.Delete("test")
+	require.NoError(t, err)
+
+	data, err = s.Get("test")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Delete not found.
+	err = s.Delete("test")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestFileStorage_Persist(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	err := newFileStorage(path, "secret").Set("test", "foobar")
+	require.NoError(t, err)
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(raw), "foobar")
+
+	// Another instance reads the same file.
+	data, err := newFileStorage(path, "secret").Get("test")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+
+	// No leftover temporary files, the lock file is kept.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+
+	for _, e := range entries {
+		if e.Name() != "storage.json.lock" {
+			names = append(names, e.Name())
+		}
+	}
+
+	assert.Equal(t, []string{"storage.json"}, names)
+}
+
+func TestFileStorage_WrongPassphrase(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	err := newFileStorage(path, "secret").Set("test", "foobar")
+	require.NoError(t, err)
+
+	data, err := newFileStorage(path, "wrong").Get("test")
+
+	assert.Empty(t, data)
+	assert.ErrorIs(t, err, n26keychain.ErrFileDecryptionFailed)
+}
+
+func TestFileStorage_Tampered(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	err := newFileStorage(path, "secret").Set("test", "foobar")
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Change the kdf parameters, which are authenticated.
+	tampered := []byte(strings.Replace(string(raw), `"p":1`, `"p":2`, 1))
+
+	err = os.WriteFile(path, tampered, 0o600)
+	require.NoError(t, err)
+
+	_, err = newFileStorage(path, "secret").Get("test")
+
+	assert.ErrorIs(t, err, n26keychain.ErrFileDecryptionFailed)
+}
+
+func TestFileStorage_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		content  string
+	}{
+		{
+			scenario: "not json",
+			content:  "{",
+		},
+		{
+			scenario: "unknown version",
+			content:  `{"version":42,"kdf":{"name":"scrypt"}}`,
+		},
+		{
+			scenario: "unknown kdf",
+			content:  `{"version":1,"kdf":{"name":"md5"}}`,
+		},
+		{
+			scenario: "scrypt memory too large",
+			content:  `{"version":1,"kdf":{"name":"scrypt","salt":"AAAAAAAAAAAAAAAAAAAAAA==","n":1048576,"r":16,"p":1}}`,
+		},
+		{
+			scenario: "scrypt parallelism too large",
+			content:  `{"version":1,"kdf":{"name":"scrypt","salt":"AAAAAAAAAAAAAAAAAAAAAA==","n":1024,"r":8,"p":1024}}`,
+		},
+		{
+			scenario: "scrypt overflow",
+			content:  `{"version":1,"kdf":{"name":"scrypt","salt":"AAAAAAAAAAAAAAAAAAAAAA==","n":1024,"r":9223372036854775807,"p":1}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "storage.json")
+
+			err := os.WriteFile(path, []byte(tc.content), 0o600)
+			require.NoError(t, err)
+
+			_, err = newFileStorage(path, "secret").Get("test")
+
+			assert.ErrorIs(t, err, n26keychain.ErrFileUnsupported)
+		})
+	}
+}
+
+func TestFileStorage_InvalidScryptParams(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		n, r, p  int
+	}{
+		{scenario: "n is not a power of two", n: 1000, r: 8, p: 1},
+		{scenario: "memory too large", n: 1 << 20, r: 16, p: 1},
+		{scenario: "parallelism too large", n: 1024, r: 8, p: 17},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "storage.json")
+			s := n26keychain.NewFileStorage(path, "secret", n26keychain.WithScryptParams(tc.n, tc.r, tc.p))
+
+			err := s.Set("test", "foobar")
+
+			assert.ErrorIs(t, err, n26keychain.ErrInvalidScryptParams)
+
+			// Nothing is written.
+			_, err = os.Stat(path)
+
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+func TestFileStorage_SharedFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	// Each storage stands for a process that shares the file.
+	storages := []n26keychain.Storage{newFileStorage(path, "secret"), newFileStorage(path, "secret")}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		i := i
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, storages[i%2].Set(fmt.Sprintf("key-%d", i), "value"))
+		}()
+	}
+
+	wg.Wait()
+
+	keys, err := n26keychain.Keys(newFileStorage(path, "secret"))
+	require.NoError(t, err)
+
+	assert.Len(t, keys, 20)
+}
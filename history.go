@@ -0,0 +1,318 @@
+package n26keychain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+)
+
+const (
+	// DefaultHistoryLimit is the number of versions that are kept for each key.
+	DefaultHistoryLimit = 5
+
+	historyKeySuffix = "#history"
+)
+
+var (
+	// ErrHistoryNotSupported indicates that the storage does not keep the history of the values.
+	ErrHistoryNotSupported = errors.New("storage does not support history")
+	// ErrHistoryVersionNotFound indicates that the version is not in the history.
+	ErrHistoryVersionNotFound = errors.New("version not found in history")
+)
+
+var (
+	_ Storage        = (*historyStorage)(nil)
+	_ StorageContext = (*historyStorage)(nil)
+	_ HistoryKeeper  = (*historyStorage)(nil)
+	_ Lister         = (*historyStorage)(nil)
+	_ Notifier       = (*historyStorage)(nil)
+)
+
+// HistoryKeeper is a storage that keeps the previous values of each key.
+type HistoryKeeper interface {
+	// History returns the versions of the key, from the oldest to the newest, which is the current value.
+	History(user string) ([]HistoryEntry, error)
+	// Rollback sets the value of a version as the current value. It is recorded as a new version.
+	Rollback(user string, version int) error
+}
+
+// HistoryEntry is a version of a value.
+type HistoryEntry struct {
+	Version   int       `json:"version"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HistoryStorageOption configures the history storage.
+type HistoryStorageOption func(s *historyStorage)
+
+type historyStorage struct {
+	storage StorageContext
+	clock   clock.Clock
+	limit   int
+
+	mu sync.Mutex
+}
+
+// Set sets password and records it as a new version.
+func (s *historyStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password and records it as a new version.
+func (s *historyStorage) SetContext(ctx context.Context, user, password string) error {
+	if strings.HasSuffix(user, historyKeySuffix) {
+		return fmt.Errorf("%q is reserved for the history", user)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(ctx, user, password)
+}
+
+// Get gets password from the underlying storage.
+func (s *historyStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage.
+func (s *historyStorage) GetContext(ctx context.Context, user string) (string, error) {
+	return s.storage.GetContext(ctx, user)
+}
+
+// Delete deletes secret and its history.
+func (s *historyStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret and its history.
+func (s *historyStorage) DeleteContext(ctx context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleteErr := s.storage.DeleteContext(ctx, user)
+	if deleteErr != nil && !errors.Is(deleteErr, keyring.ErrNotFound) {
+		return deleteErr
+	}
+
+	if err := s.storage.DeleteContext(ctx, historyKey(user)); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+
+	return deleteErr
+}
+
+// History returns the versions of the key, from the oldest to the newest.
+func (s *historyStorage) History(user string) ([]HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readHistory(context.Background(), user)
+}
+
+// Rollback sets the value of a version as the current value.
+func (s *historyStorage) Rollback(user string, version int) error {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.readHistory(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Version == version {
+			return s.set(ctx, user, e.Value)
+		}
+	}
+
+	return fmt.Errorf("%w: %q version %d", ErrHistoryVersionNotFound, user, version)
+}
+
+// Keys returns the keys in the underlying storage without the history entries, if it supports listing.
+func (s *historyStorage) Keys() ([]string, error) {
+	keys, err := listKeys(s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		if !strings.HasSuffix(k, historyKeySuffix) {
+			result = append(result, k)
+		}
+	}
+
+	return result, nil
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *historyStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+func (s *historyStorage) set(ctx context.Context, user, password string) error {
+	previous, err := s.readHistory(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	entries := previous
+
+	// The value that was set before the history was kept is its first version, so it can be rolled back to.
+	if len(entries) == 0 {
+		current, err := s.storage.GetContext(ctx, user)
+
+		switch {
+		case err == nil:
+			entries = []HistoryEntry{{Version: 1, Value: current}}
+
+		case !errors.Is(err, keyring.ErrNotFound):
+			return err
+		}
+	}
+
+	version := 1
+
+	if len(entries) > 0 {
+		version = entries[len(entries)-1].Version + 1
+	}
+
+	entries = append(entries, HistoryEntry{Version: version, Value: password, Timestamp: s.clock.Now()})
+
+	if len(entries) > s.limit {
+		entries = entries[len(entries)-s.limit:]
+	}
+
+	// The history is written before the value, so the value never changes without its version. When the value can not
+	// be written, the previous history is restored.
+	if err := s.writeHistory(ctx, user, entries); err != nil {
+		return err
+	}
+
+	if err := s.storage.SetContext(ctx, user, password); err != nil {
+		_ = s.writeHistory(ctx, user, previous) //nolint: errcheck
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *historyStorage) writeHistory(ctx context.Context, user string, entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		err := s.storage.DeleteContext(ctx, historyKey(user))
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.SetContext(ctx, historyKey(user), string(data))
+}
+
+func (s *historyStorage) readHistory(ctx context.Context, user string) ([]HistoryEntry, error) {
+	data, err := s.storage.GetContext(ctx, historyKey(user))
+	if err != nil {
+		if errors.Is(err, keyring.ErrNotFound) {
+			return []HistoryEntry{}, nil
+		}
+
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("could not unmarshal history: %w", err)
+	}
+
+	return entries, nil
+}
+
+func historyKey(user string) string {
+	return user + historyKeySuffix
+}
+
+// NewHistoryStorage creates a storage that keeps the last versions of each key, up to the limit, in an entry next to
+// the key, so a bad write can be rolled back. DefaultHistoryLimit is used if the limit is not positive. Deleting a key
+// also deletes its history.
+//
+// A value that was set before the history was kept becomes the first version, without a timestamp, on the next write.
+func NewHistoryStorage(storage Storage, limit int, options ...HistoryStorageOption) Storage {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
+	s := &historyStorage{
+		storage: ToStorageContext(storage),
+		clock:   clock.New(),
+		limit:   limit,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithHistoryClock sets the clock of the history storage.
+func WithHistoryClock(c clock.Clock) HistoryStorageOption {
+	return func(s *historyStorage) {
+		s.clock = c
+	}
+}
+
+// History returns the versions of the key, if the storage keeps them. Otherwise, ErrHistoryNotSupported is returned.
+func History(s Storage, user string) ([]HistoryEntry, error) {
+	h, ok := historyKeeperOf(s)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+
+	return h.History(user)
+}
+
+// Rollback sets the value of a version as the current value, if the storage keeps the history. Otherwise,
+// ErrHistoryNotSupported is returned.
+func Rollback(s Storage, user string, version int) error {
+	h, ok := historyKeeperOf(s)
+	if !ok {
+		return ErrHistoryNotSupported
+	}
+
+	return h.Rollback(user, version)
+}
+
+func historyKeeperOf(s interface{}) (HistoryKeeper, bool) {
+	switch s := s.(type) {
+	case *storageContext:
+		return historyKeeperOf(s.storage)
+
+	case *storageNoContext:
+		return historyKeeperOf(s.storage)
+
+	case HistoryKeeper:
+		return s, true
+	}
+
+	return nil, false
+}
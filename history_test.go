@@ -0,0 +1,199 @@
+package n26keychain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestHistoryStorage(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewHistoryStorage(memory, 3, n26keychain.WithHistoryClock(clock.Fix(ts)))
+
+	history, err := n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	assert.Empty(t, history)
+
+	for _, v := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, s.Set("foo", v))
+	}
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "4", data)
+	assert.NoError(t, err)
+
+	// The oldest version is pruned.
+	history, err = n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	expected := []n26keychain.HistoryEntry{
+		{Version: 2, Value: "2", Timestamp: ts},
+		{Version: 3, Value: "3", Timestamp: ts},
+		{Version: 4, Value: "4", Timestamp: ts},
+	}
+
+	assert.Equal(t, expected, history)
+
+	// Rollback.
+	err = n26keychain.Rollback(s, "foo", 1)
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryVersionNotFound)
+
+	require.NoError(t, n26keychain.Rollback(s, "foo", 2))
+
+	data, err = s.Get("foo")
+
+	assert.Equal(t, "2", data)
+	assert.NoError(t, err)
+
+	history, err = n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	expected = []n26keychain.HistoryEntry{
+		{Version: 3, Value: "3", Timestamp: ts},
+		{Version: 4, Value: "4", Timestamp: ts},
+		{Version: 5, Value: "2", Timestamp: ts},
+	}
+
+	assert.Equal(t, expected, history)
+
+	// The history entries are not listed.
+	require.NoError(t, s.Set("bar", "1"))
+
+	keys, err := n26keychain.Keys(s)
+
+	assert.Equal(t, []string{"bar", "foo"}, keys)
+	assert.NoError(t, err)
+
+	// Delete.
+	require.NoError(t, s.Delete("foo"))
+
+	_, err = memory.Get("foo#history")
+
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+
+	history, err = n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	assert.Empty(t, history)
+
+	err = s.Delete("foo")
+
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+}
+
+func TestHistoryStorage_ReservedKey(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0)
+
+	err := s.Set("foo#history", "1")
+
+	assert.EqualError(t, err, `"foo#history" is reserved for the history`)
+}
+
+func TestHistoryStorage_Namespaced(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewNamespacedStorage(n26keychain.NewHistoryStorage(memory, 0), "staging")
+
+	require.NoError(t, s.Set("foo", "1"))
+	require.NoError(t, s.Set("foo", "2"))
+	require.NoError(t, n26keychain.Rollback(s, "foo", 1))
+
+	data, err := memory.Get("staging:foo")
+
+	assert.Equal(t, "1", data)
+	assert.NoError(t, err)
+
+	history, err := n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	assert.Len(t, history, 3)
+}
+
+func TestHistoryStorage_SetError(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewHistoryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo#history").Return("", keyring.ErrNotFound)
+		s.On("Get", "foo").Return("", keyring.ErrNotFound)
+		s.On("Set", "foo#history", testifyMock.Anything).Return(nil)
+		s.On("Set", "foo", "1").Return(errors.New("set error"))
+		// The previous history is restored.
+		s.On("Delete", "foo#history").Return(nil)
+	})(t), 0)
+
+	err := s.Set("foo", "1")
+
+	assert.EqualError(t, err, "set error")
+}
+
+func TestHistoryStorage_ExistingValue(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewHistoryStorage(memory, 0, n26keychain.WithHistoryClock(clock.Fix(ts)))
+
+	require.NoError(t, memory.Set("foo", "old"))
+	require.NoError(t, s.Set("foo", "new"))
+
+	history, err := n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	expected := []n26keychain.HistoryEntry{
+		{Version: 1, Value: "old"},
+		{Version: 2, Value: "new", Timestamp: ts},
+	}
+
+	assert.Equal(t, expected, history)
+
+	require.NoError(t, n26keychain.Rollback(s, "foo", 1))
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "old", data)
+	assert.NoError(t, err)
+}
+
+func TestHistoryStorage_CorruptedHistory(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewHistoryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", testifyMock.Anything).Return("{", nil)
+	})(t), 0)
+
+	_, err := n26keychain.History(s, "foo")
+
+	assert.ErrorContains(t, err, "could not unmarshal history")
+}
+
+func TestHistory_NotSupported(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewMemoryStorage()
+
+	_, err := n26keychain.History(s, "foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+
+	err = n26keychain.Rollback(n26keychain.FromStorageContext(n26keychain.ToStorageContext(s)), "foo", 1)
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+}
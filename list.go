@@ -0,0 +1,259 @@
+package n26keychain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// IndexKey is the key of the entry that holds the index of the indexed storage.
+const IndexKey = "n26keychain:index"
+
+// ErrListNotSupported indicates that the storage can not enumerate its keys.
+var ErrListNotSupported = errors.New("storage does not support listing keys")
+
+var (
+	_ Storage        = (*indexedStorage)(nil)
+	_ StorageContext = (*indexedStorage)(nil)
+	_ Lister         = (*indexedStorage)(nil)
+	_ Notifier       = (*indexedStorage)(nil)
+	_ Versioned      = (*indexedStorage)(nil)
+	_ HistoryKeeper  = (*indexedStorage)(nil)
+)
+
+// Lister is a storage that can enumerate its keys.
+type Lister interface {
+	// Keys returns all the keys in the storage.
+	Keys() ([]string, error)
+}
+
+type indexedStorage struct {
+	storage StorageContext
+
+	mu sync.Mutex
+}
+
+// Set sets password in the underlying storage and adds the key to the index.
+func (s *indexedStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage and adds the key to the index.
+func (s *indexedStorage) SetContext(ctx context.Context, user, password string) error {
+	if user == IndexKey {
+		return fmt.Errorf("%q is reserved for the index", IndexKey)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.storage.SetContext(ctx, user, password); err != nil {
+		return err
+	}
+
+	return s.addKey(ctx, user)
+}
+
+// Get gets password from the underlying storage.
+func (s *indexedStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage.
+func (s *indexedStorage) GetContext(ctx context.Context, user string) (string, error) {
+	return s.storage.GetContext(ctx, user)
+}
+
+// Delete deletes secret from the underlying storage and removes the key from the index.
+func (s *indexedStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage and removes the key from the index.
+func (s *indexedStorage) DeleteContext(ctx context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleteErr := s.storage.DeleteContext(ctx, user)
+	if deleteErr != nil && !errors.Is(deleteErr, keyring.ErrNotFound) {
+		return deleteErr
+	}
+
+	err := s.updateIndex(ctx, func(index map[string]struct{}) bool {
+		if _, ok := index[user]; !ok {
+			return false
+		}
+
+		delete(index, user)
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return deleteErr
+}
+
+// Keys returns the keys in the index.
+func (s *indexedStorage) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readIndex(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(index), nil
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *indexedStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version from the underlying storage, if it supports versions.
+func (s *indexedStorage) GetVersion(user string) (string, string, error) {
+	return GetVersion(FromStorageContext(s.storage), user)
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions, and adds the key to the index.
+func (s *indexedStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	if user == IndexKey {
+		return "", fmt.Errorf("%q is reserved for the index", IndexKey)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+	if err != nil {
+		return "", err
+	}
+
+	return version, s.addKey(context.Background(), user)
+}
+
+// History returns the versions of the key, if the underlying storage keeps them.
+func (s *indexedStorage) History(user string) ([]HistoryEntry, error) {
+	return History(FromStorageContext(s.storage), user)
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history, and adds the
+// key to the index.
+func (s *indexedStorage) Rollback(user string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := Rollback(FromStorageContext(s.storage), user, version); err != nil {
+		return err
+	}
+
+	return s.addKey(context.Background(), user)
+}
+
+func (s *indexedStorage) addKey(ctx context.Context, user string) error {
+	return s.updateIndex(ctx, func(index map[string]struct{}) bool {
+		if _, ok := index[user]; ok {
+			return false
+		}
+
+		index[user] = struct{}{}
+
+		return true
+	})
+}
+
+func (s *indexedStorage) readIndex(ctx context.Context) (map[string]struct{}, error) {
+	data, err := s.storage.GetContext(ctx, IndexKey)
+	if err != nil {
+		if errors.Is(err, keyring.ErrNotFound) {
+			return make(map[string]struct{}), nil
+		}
+
+		return nil, err
+	}
+
+	var keys []string
+
+	if err := json.Unmarshal([]byte(data), &keys); err != nil {
+		return nil, fmt.Errorf("could not unmarshal index: %w", err)
+	}
+
+	index := make(map[string]struct{}, len(keys))
+
+	for _, k := range keys {
+		index[k] = struct{}{}
+	}
+
+	return index, nil
+}
+
+func (s *indexedStorage) updateIndex(ctx context.Context, update func(index map[string]struct{}) bool) error {
+	index, err := s.readIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !update(index) {
+		return nil
+	}
+
+	if len(index) == 0 {
+		err := s.storage.DeleteContext(ctx, IndexKey)
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	}
+
+	data, err := json.Marshal(sortedKeys(index))
+	if err != nil {
+		return err
+	}
+
+	return s.storage.SetContext(ctx, IndexKey, string(data))
+}
+
+// NewIndexedStorage creates a storage that maintains the list of its keys in an entry of the underlying storage, see
+// IndexKey, for the backends that can not enumerate their entries, like the system keyring. The keys that were set
+// before the index was used are not listed.
+func NewIndexedStorage(storage Storage) Storage {
+	return &indexedStorage{
+		storage: ToStorageContext(storage),
+	}
+}
+
+// Keys returns all the keys in the storage, if it supports listing. Otherwise, ErrListNotSupported is returned.
+func Keys(s Storage) ([]string, error) {
+	return listKeys(s)
+}
+
+func listKeys(s interface{}) ([]string, error) {
+	l, ok := s.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+
+	return l.Keys()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,342 @@
+package n26keychain_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestIndexedStorage(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewIndexedStorage(memory)
+
+	keys, err := n26keychain.Keys(s)
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+
+	// Set.
+	require.NoError(t, s.Set("foo", "1"))
+	require.NoError(t, s.Set("bar", "2"))
+	require.NoError(t, s.Set("foo", "3"))
+
+	keys, err = n26keychain.Keys(s)
+
+	assert.Equal(t, []string{"bar", "foo"}, keys)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `["bar","foo"]`, memory.Snapshot()[n26keychain.IndexKey])
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "3", data)
+	assert.NoError(t, err)
+
+	// Delete.
+	require.NoError(t, s.Delete("foo"))
+
+	keys, err = n26keychain.Keys(s)
+
+	assert.Equal(t, []string{"bar"}, keys)
+	assert.NoError(t, err)
+
+	err = s.Delete("foo")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// The index is removed with the last key.
+	require.NoError(t, s.Delete("bar"))
+
+	assert.Empty(t, memory.Snapshot())
+}
+
+func TestIndexedStorage_StaleIndex(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewIndexedStorage(memory)
+
+	require.NoError(t, s.Set("foo", "1"))
+	require.NoError(t, memory.Delete("foo"))
+
+	// The stale key is removed from the index.
+	err := s.Delete("foo")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	keys, err := n26keychain.Keys(s)
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+}
+
+func TestIndexedStorage_ReservedKey(t *testing.T) {
+	t.Parallel()
+
+	err := n26keychain.NewIndexedStorage(n26keychain.NewMemoryStorage()).Set(n26keychain.IndexKey, "foobar")
+
+	assert.EqualError(t, err, `"n26keychain:index" is reserved for the index`)
+}
+
+func TestIndexedStorage_Error(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		mockStorage   mock.StorageMocker
+		call          func(s n26keychain.Storage) error
+		expectedError string
+	}{
+		{
+			scenario: "could not set",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "foo", "bar").Return(errors.New("set error"))
+			}),
+			call: func(s n26keychain.Storage) error {
+				return s.Set("foo", "bar")
+			},
+			expectedError: "set error",
+		},
+		{
+			scenario: "could not get index",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "foo", "bar").Return(nil)
+				s.On("Get", n26keychain.IndexKey).Return("", errors.New("get error"))
+			}),
+			call: func(s n26keychain.Storage) error {
+				return s.Set("foo", "bar")
+			},
+			expectedError: "get error",
+		},
+		{
+			scenario: "invalid index",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", n26keychain.IndexKey).Return("{", nil)
+			}),
+			call: func(s n26keychain.Storage) error {
+				_, err := n26keychain.Keys(s)
+
+				return err
+			},
+			expectedError: "could not unmarshal index: unexpected end of JSON input",
+		},
+		{
+			scenario: "could not delete",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "foo").Return(errors.New("delete error"))
+			}),
+			call: func(s n26keychain.Storage) error {
+				return s.Delete("foo")
+			},
+			expectedError: "delete error",
+		},
+		{
+			scenario: "could not delete index",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Delete", "foo").Return(nil)
+				s.On("Get", n26keychain.IndexKey).Return(`["foo"]`, nil)
+				s.On("Delete", n26keychain.IndexKey).Return(errors.New("delete error"))
+			}),
+			call: func(s n26keychain.Storage) error {
+				return s.Delete("foo")
+			},
+			expectedError: "delete error",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.call(n26keychain.NewIndexedStorage(tc.mockStorage(t)))
+
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestIndexedStorage_Versioned(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewIndexedStorage(n26keychain.NewVersionedStorage(n26keychain.NewMemoryStorage()))
+
+	version, err := n26keychain.SetIfMatch(s, "foo", "", "bar")
+	require.NoError(t, err)
+
+	password, current, err := n26keychain.GetVersion(s, "foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", password)
+	assert.Equal(t, version, current)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", "", "baz")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	_, err = n26keychain.SetIfMatch(s, n26keychain.IndexKey, "", "baz")
+	require.EqualError(t, err, `"n26keychain:index" is reserved for the index`)
+
+	// The conditional write adds the key to the index.
+	keys, err := n26keychain.Keys(s)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"foo"}, keys)
+}
+
+func TestIndexedStorage_History(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewIndexedStorage(n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0))
+
+	require.NoError(t, s.Set("foo", "1"))
+	require.NoError(t, s.Set("foo", "2"))
+
+	history, err := n26keychain.History(s, "foo")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	require.NoError(t, n26keychain.Rollback(s, "foo", history[0].Version))
+
+	password, err := s.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1", password)
+
+	err = n26keychain.Rollback(s, "foo", 42)
+	require.ErrorIs(t, err, n26keychain.ErrHistoryVersionNotFound)
+
+	keys, err := n26keychain.Keys(s)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"foo"}, keys)
+}
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+
+	newMemory := func() n26keychain.Storage {
+		s := n26keychain.NewMemoryStorage()
+
+		s.Restore(map[string]string{"foo": "1", "bar": "2"})
+
+		return s
+	}
+
+	testCases := []struct {
+		scenario      string
+		storage       func(t *testing.T) n26keychain.Storage
+		expectedKeys  []string
+		expectedError error
+	}{
+		{
+			scenario: "not supported",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				return mock.NoMockStorage(t)
+			},
+			expectedError: n26keychain.ErrListNotSupported,
+		},
+		{
+			scenario: "memory",
+			storage: func(*testing.T) n26keychain.Storage {
+				return newMemory()
+			},
+			expectedKeys: []string{"bar", "foo"},
+		},
+		{
+			scenario: "file",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				s := newFileStorage(filepath.Join(t.TempDir(), "storage.json"), "secret")
+
+				require.NoError(t, s.Set("foo", "1"))
+				require.NoError(t, s.Set("bar", "2"))
+
+				return s
+			},
+			expectedKeys: []string{"bar", "foo"},
+		},
+		{
+			scenario: "context without listing",
+			storage: func(*testing.T) n26keychain.Storage {
+				return n26keychain.FromStorageContext(contextOnly{n26keychain.ToStorageContext(newMemory())})
+			},
+			expectedError: n26keychain.ErrListNotSupported,
+		},
+		{
+			scenario: "cache",
+			storage: func(*testing.T) n26keychain.Storage {
+				return n26keychain.NewCacheStorage(newMemory(), time.Minute)
+			},
+			expectedKeys: []string{"bar", "foo"},
+		},
+		{
+			scenario: "encrypted",
+			storage: func(*testing.T) n26keychain.Storage {
+				return n26keychain.NewEncryptedStorage(newMemory(), n26keychain.NewStaticKeyProvider("key", masterKey1))
+			},
+			expectedKeys: []string{"bar", "foo"},
+		},
+		{
+			scenario: "chunked",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				s := n26keychain.NewChunkedStorage(newMemory(), 10)
+
+				require.NoError(t, s.Set("baz", strings.Repeat("0123456789", 3)))
+
+				return s
+			},
+			expectedKeys: []string{"bar", "baz", "foo"},
+		},
+		{
+			scenario: "chain",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				other := n26keychain.NewMemoryStorage()
+
+				require.NoError(t, other.Set("baz", "3"))
+				require.NoError(t, other.Set("foo", "4"))
+
+				return n26keychain.NewChainStorage([]n26keychain.Storage{mock.NoMockStorage(t), newMemory(), other})
+			},
+			expectedKeys: []string{"bar", "baz", "foo"},
+		},
+		{
+			scenario: "chain not supported",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				return n26keychain.NewChainStorage([]n26keychain.Storage{mock.NoMockStorage(t)})
+			},
+			expectedError: n26keychain.ErrListNotSupported,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			keys, err := n26keychain.Keys(tc.storage(t))
+
+			assert.Equal(t, tc.expectedKeys, keys)
+			assert.ErrorIs(t, err, tc.expectedError)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package n26keychain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+var (
+	_ Storage  = (*MemoryStorage)(nil)
+	_ Lister   = (*MemoryStorage)(nil)
+	_ Notifier = (*MemoryStorage)(nil)
+)
+
+// MemoryStorage is a concurrency-safe storage that keeps the entries in memory.
+type MemoryStorage struct {
+	mu          sync.RWMutex
+	entries     map[string]string
+	subscribers map[chan struct{}]struct{}
+}
+
+// Set sets password in memory for user.
+func (s *MemoryStorage) Set(user, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[user] = password
+	s.notify()
+
+	return nil
+}
+
+// Get gets password from memory.
+func (s *MemoryStorage) Get(user string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	password, ok := s.entries[user]
+	if !ok {
+		return "", keyring.ErrNotFound
+	}
+
+	return password, nil
+}
+
+// Delete deletes secret from memory.
+func (s *MemoryStorage) Delete(user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[user]; !ok {
+		return keyring.ErrNotFound
+	}
+
+	delete(s.entries, user)
+	s.notify()
+
+	return nil
+}
+
+// Keys returns all the keys in memory.
+func (s *MemoryStorage) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedKeys(s.entries), nil
+}
+
+// Snapshot returns a copy of all the entries.
+func (s *MemoryStorage) Snapshot() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return copyEntries(s.entries)
+}
+
+// Restore replaces all the entries with a copy of the given snapshot.
+func (s *MemoryStorage) Restore(snapshot map[string]string) {
+	entries := copyEntries(snapshot)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = entries
+	s.notify()
+}
+
+// Notify returns a channel that receives a value when the entries change. The channel is closed when the context is
+// done.
+func (s *MemoryStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subscribers, ch)
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// notify notifies the subscribers without blocking. The caller must hold the write lock.
+func (s *MemoryStorage) notify() {
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func copyEntries(entries map[string]string) map[string]string {
+	result := make(map[string]string, len(entries))
+
+	for k, v := range entries {
+		result[k] = v
+	}
+
+	return result
+}
+
+// NewMemoryStorage creates an in-memory storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		entries:     make(map[string]string),
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
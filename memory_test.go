@@ -0,0 +1,109 @@
+package n26keychain_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewMemoryStorage()
+
+	// Get not found.
+	data, err := s.Get("test")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Set.
+	err = s.Set("test", "foobar")
+	require.NoError(t, err)
+
+	data, err = s.Get("test")
+
+	assert.Equal(t, "foobar", data)
+	assert.NoError(t, err)
+
+	// Delete.
+	err = s.Delete("test")
+	require.NoError(t, err)
+
+	data, err = s.Get("test")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Delete not found.
+	err = s.Delete("test")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestMemoryStorage_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewMemoryStorage()
+
+	err := s.Set("foo", "bar")
+	require.NoError(t, err)
+
+	snapshot := s.Snapshot()
+
+	assert.Equal(t, map[string]string{"foo": "bar"}, snapshot)
+
+	// The snapshot is a copy.
+	snapshot["john"] = "doe"
+
+	_, err = s.Get("john")
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	err = s.Set("foo", "baz")
+	require.NoError(t, err)
+
+	// Restore.
+	s.Restore(snapshot)
+
+	assert.Equal(t, map[string]string{"foo": "bar", "john": "doe"}, s.Snapshot())
+
+	// The restored entries are a copy.
+	snapshot["foo"] = "qux"
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "bar", data)
+	assert.NoError(t, err)
+}
+
+func TestMemoryStorage_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewMemoryStorage()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i%5)
+
+			_ = s.Set(key, "value")
+			_, _ = s.Get(key)
+			_ = s.Delete(key)
+
+			s.Restore(s.Snapshot())
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,209 @@
+package n26keychain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+)
+
+// Metrics operations.
+const (
+	MetricsOperationGet      = "get"
+	MetricsOperationSet      = "set"
+	MetricsOperationDelete   = "delete"
+	MetricsOperationHistory  = "history"
+	MetricsOperationRollback = "rollback"
+)
+
+// Error classes of the operations.
+const (
+	ErrorClassNone        = "none"
+	ErrorClassNotFound    = "not_found"
+	ErrorClassUnavailable = "unavailable"
+	ErrorClassTooBig      = "too_big"
+	ErrorClassUnmarshal   = "unmarshal"
+	ErrorClassOther       = "other"
+)
+
+var (
+	_ Storage        = (*metricsStorage)(nil)
+	_ StorageContext = (*metricsStorage)(nil)
+	_ Lister         = (*metricsStorage)(nil)
+	_ Notifier       = (*metricsStorage)(nil)
+	_ Versioned      = (*metricsStorage)(nil)
+	_ HistoryKeeper  = (*metricsStorage)(nil)
+)
+
+// Metrics records the storage operations.
+type Metrics interface {
+	// ObserveOperation records an operation of the storage of the service, its error class and how long it took.
+	ObserveOperation(service, operation, errorClass string, duration time.Duration)
+}
+
+// MetricsStorageOption configures the metrics storage.
+type MetricsStorageOption func(s *metricsStorage)
+
+type metricsStorage struct {
+	storage StorageContext
+	metrics Metrics
+	clock   clock.Clock
+	service string
+}
+
+// Set sets password in the underlying storage and records the operation.
+func (s *metricsStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage and records the operation.
+func (s *metricsStorage) SetContext(ctx context.Context, user, password string) error {
+	start := s.clock.Now()
+	err := s.storage.SetContext(ctx, user, password)
+
+	s.observe(MetricsOperationSet, start, err)
+
+	return err
+}
+
+// Get gets password from the underlying storage and records the operation.
+func (s *metricsStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage and records the operation.
+func (s *metricsStorage) GetContext(ctx context.Context, user string) (string, error) {
+	start := s.clock.Now()
+	password, err := s.storage.GetContext(ctx, user)
+
+	s.observe(MetricsOperationGet, start, err)
+
+	return password, err
+}
+
+// Delete deletes secret from the underlying storage and records the operation.
+func (s *metricsStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage and records the operation.
+func (s *metricsStorage) DeleteContext(ctx context.Context, user string) error {
+	start := s.clock.Now()
+	err := s.storage.DeleteContext(ctx, user)
+
+	s.observe(MetricsOperationDelete, start, err)
+
+	return err
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *metricsStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *metricsStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions, and records the operation as
+// a get.
+func (s *metricsStorage) GetVersion(user string) (string, string, error) {
+	start := s.clock.Now()
+	password, version, err := GetVersion(FromStorageContext(s.storage), user)
+
+	s.observe(MetricsOperationGet, start, err)
+
+	return password, version, err
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions, and records the operation as a set.
+func (s *metricsStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	start := s.clock.Now()
+	version, err := SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+
+	s.observe(MetricsOperationSet, start, err)
+
+	return version, err
+}
+
+// History returns the versions of the key, if the underlying storage keeps them, and records the operation.
+func (s *metricsStorage) History(user string) ([]HistoryEntry, error) {
+	start := s.clock.Now()
+	entries, err := History(FromStorageContext(s.storage), user)
+
+	s.observe(MetricsOperationHistory, start, err)
+
+	return entries, err
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history, and records
+// the operation.
+func (s *metricsStorage) Rollback(user string, version int) error {
+	start := s.clock.Now()
+	err := Rollback(FromStorageContext(s.storage), user, version)
+
+	s.observe(MetricsOperationRollback, start, err)
+
+	return err
+}
+
+func (s *metricsStorage) observe(operation string, start time.Time, err error) {
+	s.metrics.ObserveOperation(s.service, operation, ErrorClass(err), s.clock.Now().Sub(start))
+}
+
+// NewMetricsStorage creates a storage that records the count, the duration and the error class of every operation of
+// the underlying storage, labeled with the service.
+func NewMetricsStorage(storage Storage, service string, metrics Metrics, options ...MetricsStorageOption) Storage {
+	s := &metricsStorage{
+		storage: ToStorageContext(storage),
+		metrics: metrics,
+		clock:   clock.New(),
+		service: service,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithMetricsClock sets the clock of the metrics storage.
+func WithMetricsClock(c clock.Clock) MetricsStorageOption {
+	return func(s *metricsStorage) {
+		s.clock = c
+	}
+}
+
+// ErrorClass returns the class of the error of an operation, for the metrics: ErrorClassNone, ErrorClassNotFound,
+// ErrorClassUnavailable, ErrorClassTooBig, ErrorClassUnmarshal or ErrorClassOther.
+func ErrorClass(err error) string {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	switch {
+	case err == nil:
+		return ErrorClassNone
+
+	case errors.Is(err, keyring.ErrNotFound):
+		return ErrorClassNotFound
+
+	case errors.Is(err, keyring.ErrSetDataTooBig):
+		return ErrorClassTooBig
+
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrorClassUnmarshal
+
+	case IsUnavailable(err):
+		return ErrorClassUnavailable
+	}
+
+	return ErrorClassOther
+}
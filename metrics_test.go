@@ -0,0 +1,141 @@
+package n26keychain_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+type operation struct {
+	service    string
+	operation  string
+	errorClass string
+}
+
+type metricsRecorder struct {
+	operations []operation
+}
+
+func (r *metricsRecorder) ObserveOperation(service, op, errorClass string, _ time.Duration) {
+	r.operations = append(r.operations, operation{service: service, operation: op, errorClass: errorClass})
+}
+
+func TestMetricsStorage(t *testing.T) {
+	t.Parallel()
+
+	r := &metricsRecorder{}
+	s := n26keychain.NewMetricsStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "bar").Return(keyring.ErrSetDataTooBig)
+		s.On("Get", "foo").Return("bar", nil)
+		s.On("Delete", "foo").Return(keyring.ErrNotFound)
+	})(t), "service", r, n26keychain.WithMetricsClock(clock.New()))
+
+	_ = s.Set("foo", "bar") //nolint: errcheck
+	_, _ = s.Get("foo")     //nolint: errcheck
+	_ = s.Delete("foo")     //nolint: errcheck
+
+	expected := []operation{
+		{service: "service", operation: "set", errorClass: "too_big"},
+		{service: "service", operation: "get", errorClass: "none"},
+		{service: "service", operation: "delete", errorClass: "not_found"},
+	}
+
+	assert.Equal(t, expected, r.operations)
+}
+
+func TestMetricsStorage_VersionedAndHistory(t *testing.T) {
+	t.Parallel()
+
+	r := &metricsRecorder{}
+	memory := n26keychain.NewMemoryStorage()
+
+	versioned := n26keychain.NewMetricsStorage(n26keychain.NewVersionedStorage(memory), "service", r)
+
+	_, version, err := n26keychain.GetVersion(versioned, "foo")
+	require.ErrorIs(t, err, keyring.ErrNotFound)
+
+	_, err = n26keychain.SetIfMatch(versioned, "foo", version, "bar")
+	require.NoError(t, err)
+
+	_, err = n26keychain.SetIfMatch(versioned, "foo", version, "baz")
+	require.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	history := n26keychain.NewMetricsStorage(n26keychain.NewHistoryStorage(memory, 0), "service", r)
+
+	entries, err := n26keychain.History(history, "foo")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	err = n26keychain.Rollback(history, "foo", 1)
+	require.ErrorIs(t, err, n26keychain.ErrHistoryVersionNotFound)
+
+	expected := []operation{
+		{service: "service", operation: "get", errorClass: "not_found"},
+		{service: "service", operation: "set", errorClass: "none"},
+		{service: "service", operation: "set", errorClass: "other"},
+		{service: "service", operation: "history", errorClass: "none"},
+		{service: "service", operation: "rollback", errorClass: "other"},
+	}
+
+	assert.Equal(t, expected, r.operations)
+}
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		error    error
+		expected string
+	}{
+		{
+			scenario: "no error",
+			expected: n26keychain.ErrorClassNone,
+		},
+		{
+			scenario: "not found",
+			error:    fmt.Errorf("get: %w", keyring.ErrNotFound),
+			expected: n26keychain.ErrorClassNotFound,
+		},
+		{
+			scenario: "unavailable",
+			error:    n26keychain.ErrUnavailable,
+			expected: n26keychain.ErrorClassUnavailable,
+		},
+		{
+			scenario: "too big",
+			error:    keyring.ErrSetDataTooBig,
+			expected: n26keychain.ErrorClassTooBig,
+		},
+		{
+			scenario: "unmarshal",
+			error:    json.Unmarshal([]byte("{"), &struct{}{}),
+			expected: n26keychain.ErrorClassUnmarshal,
+		},
+		{
+			scenario: "other",
+			error:    errors.New("error"),
+			expected: n26keychain.ErrorClassOther,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, n26keychain.ErrorClass(tc.error))
+		})
+	}
+}
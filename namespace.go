@@ -0,0 +1,121 @@
+package n26keychain
+
+import (
+	"context"
+	"strings"
+)
+
+// NamespaceSeparator separates the namespace from the key in a namespaced storage.
+const NamespaceSeparator = ":"
+
+var (
+	_ Storage        = (*namespacedStorage)(nil)
+	_ StorageContext = (*namespacedStorage)(nil)
+	_ Lister         = (*namespacedStorage)(nil)
+	_ Notifier       = (*namespacedStorage)(nil)
+	_ Versioned      = (*namespacedStorage)(nil)
+	_ HistoryKeeper  = (*namespacedStorage)(nil)
+)
+
+type namespacedStorage struct {
+	storage StorageContext
+	prefix  string
+}
+
+// Set sets password for user in the namespace.
+func (s *namespacedStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password for user in the namespace.
+func (s *namespacedStorage) SetContext(ctx context.Context, user, password string) error {
+	return s.storage.SetContext(ctx, s.prefix+user, password)
+}
+
+// Get gets password from the namespace.
+func (s *namespacedStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the namespace.
+func (s *namespacedStorage) GetContext(ctx context.Context, user string) (string, error) {
+	return s.storage.GetContext(ctx, s.prefix+user)
+}
+
+// Delete deletes secret from the namespace.
+func (s *namespacedStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the namespace.
+func (s *namespacedStorage) DeleteContext(ctx context.Context, user string) error {
+	return s.storage.DeleteContext(ctx, s.prefix+user)
+}
+
+// Keys returns the keys in the namespace, without the prefix, if the underlying storage supports listing.
+func (s *namespacedStorage) Keys() ([]string, error) {
+	keys, err := listKeys(s.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		if strings.HasPrefix(k, s.prefix) {
+			result = append(result, strings.TrimPrefix(k, s.prefix))
+		}
+	}
+
+	return result, nil
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *namespacedStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version from the namespace, if the underlying storage supports versions.
+func (s *namespacedStorage) GetVersion(user string) (string, string, error) {
+	return GetVersion(FromStorageContext(s.storage), s.prefix+user)
+}
+
+// SetIfMatch sets password in the namespace only if the current version is the expected one, if the underlying storage
+// supports versions.
+func (s *namespacedStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	return SetIfMatch(FromStorageContext(s.storage), s.prefix+user, expectedVersion, password)
+}
+
+// History returns the versions of the key in the namespace, if the underlying storage keeps them.
+func (s *namespacedStorage) History(user string) ([]HistoryEntry, error) {
+	return History(FromStorageContext(s.storage), s.prefix+user)
+}
+
+// Rollback sets the value of a version as the current value in the namespace, if the underlying storage keeps the
+// history.
+func (s *namespacedStorage) Rollback(user string, version int) error {
+	return Rollback(FromStorageContext(s.storage), s.prefix+user, version)
+}
+
+// NewNamespacedStorage creates a storage that prefixes all the keys with the namespace, so several environments or
+// accounts can share the same underlying storage without colliding. An empty namespace returns the storage as is.
+func NewNamespacedStorage(storage Storage, namespace string) Storage {
+	if namespace == "" {
+		return storage
+	}
+
+	return &namespacedStorage{
+		storage: ToStorageContext(storage),
+		prefix:  namespace + NamespaceSeparator,
+	}
+}
+
+// NamespacedService returns the name of the service in the namespace, for example "n26api.token.staging". An empty
+// namespace returns the service as is.
+func NamespacedService(service, namespace string) string {
+	if namespace == "" {
+		return service
+	}
+
+	return service + "." + namespace
+}
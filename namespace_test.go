@@ -0,0 +1,96 @@
+package n26keychain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestNamespacedStorage(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+
+	require.NoError(t, memory.Set("foo", "outside"))
+
+	staging := n26keychain.NewNamespacedStorage(memory, "staging")
+	production := n26keychain.NewNamespacedStorage(memory, "production")
+
+	// Set.
+	require.NoError(t, staging.Set("foo", "1"))
+	require.NoError(t, production.Set("foo", "2"))
+	require.NoError(t, production.Set("bar", "3"))
+
+	expected := map[string]string{
+		"foo":            "outside",
+		"staging:foo":    "1",
+		"production:foo": "2",
+		"production:bar": "3",
+	}
+
+	assert.Equal(t, expected, memory.Snapshot())
+
+	// Get.
+	data, err := staging.Get("foo")
+
+	assert.Equal(t, "1", data)
+	assert.NoError(t, err)
+
+	data, err = n26keychain.ToStorageContext(production).GetContext(context.Background(), "foo")
+
+	assert.Equal(t, "2", data)
+	assert.NoError(t, err)
+
+	data, err = staging.Get("bar")
+
+	assert.Empty(t, data)
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	// Keys.
+	keys, err := n26keychain.Keys(production)
+
+	assert.Equal(t, []string{"bar", "foo"}, keys)
+	assert.NoError(t, err)
+
+	// Delete.
+	require.NoError(t, staging.Delete("foo"))
+
+	err = staging.Delete("foo")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+
+	data, err = memory.Get("foo")
+
+	assert.Equal(t, "outside", data)
+	assert.NoError(t, err)
+}
+
+func TestNamespacedStorage_EmptyNamespace(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+
+	assert.Same(t, memory, n26keychain.NewNamespacedStorage(memory, ""))
+}
+
+func TestNamespacedStorage_KeysNotSupported(t *testing.T) {
+	t.Parallel()
+
+	keys, err := n26keychain.Keys(n26keychain.NewNamespacedStorage(mock.NoMockStorage(t), "staging"))
+
+	assert.Nil(t, keys)
+	assert.ErrorIs(t, err, n26keychain.ErrListNotSupported)
+}
+
+func TestNamespacedService(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "n26api.token", n26keychain.NamespacedService("n26api.token", ""))
+	assert.Equal(t, "n26api.token.staging", n26keychain.NamespacedService("n26api.token", "staging"))
+}
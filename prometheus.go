@@ -0,0 +1,221 @@
+package n26keychain
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	operationsTotalName   = "operations_total"
+	operationDurationName = "operation_duration_seconds"
+)
+
+// DefaultPrometheusBuckets are the upper bounds of the duration histogram, in seconds.
+var DefaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	_ Metrics      = (*PrometheusMetrics)(nil)
+	_ http.Handler = (*PrometheusMetrics)(nil)
+)
+
+// PrometheusMetricsOption configures PrometheusMetrics.
+type PrometheusMetricsOption func(m *PrometheusMetrics)
+
+type operationLabels struct {
+	service   string
+	operation string
+}
+
+type counterLabels struct {
+	operationLabels
+
+	errorClass string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// PrometheusMetrics keeps the metrics of the storage operations in memory and exposes them in the Prometheus text
+// format:
+//
+//   - n26keychain_operations_total, a counter labeled with the service, the operation and the error class.
+//   - n26keychain_operation_duration_seconds, a histogram labeled with the service and the operation.
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	mu         sync.Mutex
+	counters   map[counterLabels]uint64
+	histograms map[operationLabels]*histogram
+}
+
+// ObserveOperation records an operation.
+func (m *PrometheusMetrics) ObserveOperation(service, operation, errorClass string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := operationLabels{service: service, operation: operation}
+
+	m.counters[counterLabels{operationLabels: labels, errorClass: errorClass}]++
+
+	h, ok := m.histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.histograms[labels] = h
+	}
+
+	seconds := duration.Seconds()
+
+	for i, upper := range m.buckets {
+		if seconds <= upper {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += seconds
+	h.count++
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	m.mu.Lock()
+
+	counters := make([]counterLabels, 0, len(m.counters))
+
+	for l := range m.counters {
+		counters = append(counters, l)
+	}
+
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].operationLabels != counters[j].operationLabels {
+			return counters[i].operationLabels.less(counters[j].operationLabels)
+		}
+
+		return counters[i].errorClass < counters[j].errorClass
+	})
+
+	name := m.namespace + operationsTotalName
+
+	sb.WriteString("# HELP " + name + " Number of the keychain storage operations.\n")
+	sb.WriteString("# TYPE " + name + " counter\n")
+
+	for _, l := range counters {
+		writeSample(&sb, name, m.counters[l], l.labels()+`,error_class="`+escapeLabel(l.errorClass)+`"`)
+	}
+
+	histograms := make([]operationLabels, 0, len(m.histograms))
+
+	for l := range m.histograms {
+		histograms = append(histograms, l)
+	}
+
+	sort.Slice(histograms, func(i, j int) bool {
+		return histograms[i].less(histograms[j])
+	})
+
+	name = m.namespace + operationDurationName
+
+	sb.WriteString("# HELP " + name + " Duration of the keychain storage operations.\n")
+	sb.WriteString("# TYPE " + name + " histogram\n")
+
+	for _, l := range histograms {
+		h := m.histograms[l]
+
+		for i, upper := range m.buckets {
+			writeSample(&sb, name+"_bucket", h.counts[i], l.labels()+`,le="`+formatFloat(upper)+`"`)
+		}
+
+		writeSample(&sb, name+"_bucket", h.count, l.labels()+`,le="+Inf"`)
+		sb.WriteString(name + "_sum{" + l.labels() + "} " + formatFloat(h.sum) + "\n")
+		writeSample(&sb, name+"_count", h.count, l.labels())
+	}
+
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, sb.String())
+
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+
+	_, _ = m.WriteTo(w) //nolint: errcheck
+}
+
+func (l operationLabels) labels() string {
+	return `service="` + escapeLabel(l.service) + `",operation="` + escapeLabel(l.operation) + `"`
+}
+
+func (l operationLabels) less(other operationLabels) bool {
+	if l.service != other.service {
+		return l.service < other.service
+	}
+
+	return l.operation < other.operation
+}
+
+func writeSample(sb *strings.Builder, name string, value uint64, labels string) {
+	sb.WriteString(name + "{" + labels + "} " + strconv.FormatUint(value, 10) + "\n")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// NewPrometheusMetrics creates metrics that are exposed in the Prometheus text format, with WriteTo or as an HTTP
+// handler.
+func NewPrometheusMetrics(options ...PrometheusMetricsOption) *PrometheusMetrics {
+	m := &PrometheusMetrics{
+		namespace:  "n26keychain_",
+		buckets:    DefaultPrometheusBuckets,
+		counters:   make(map[counterLabels]uint64),
+		histograms: make(map[operationLabels]*histogram),
+	}
+
+	for _, o := range options {
+		o(m)
+	}
+
+	return m
+}
+
+// WithPrometheusNamespace sets the prefix of the metric names, "n26keychain" by default. An empty namespace removes the
+// prefix.
+func WithPrometheusNamespace(namespace string) PrometheusMetricsOption {
+	return func(m *PrometheusMetrics) {
+		if namespace == "" {
+			m.namespace = ""
+
+			return
+		}
+
+		m.namespace = namespace + "_"
+	}
+}
+
+// WithPrometheusBuckets sets the upper bounds of the duration histogram, in seconds, in increasing order.
+func WithPrometheusBuckets(buckets ...float64) PrometheusMetricsOption {
+	return func(m *PrometheusMetrics) {
+		m.buckets = buckets
+	}
+}
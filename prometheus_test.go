@@ -0,0 +1,75 @@
+package n26keychain_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewPrometheusMetrics(n26keychain.WithPrometheusBuckets(0.1, 1))
+
+	m.ObserveOperation("token", "get", "none", 50*time.Millisecond)
+	m.ObserveOperation("credentials", "set", "unavailable", 2*time.Second)
+	m.ObserveOperation("token", "get", "not_found", 500*time.Millisecond)
+	m.ObserveOperation("svc\"\n", "get", "none", 0)
+
+	var sb strings.Builder
+
+	n, err := m.WriteTo(&sb)
+	require.NoError(t, err)
+
+	expected := `# HELP n26keychain_operations_total Number of the keychain storage operations.
+# TYPE n26keychain_operations_total counter
+n26keychain_operations_total{service="credentials",operation="set",error_class="unavailable"} 1
+n26keychain_operations_total{service="svc\"\n",operation="get",error_class="none"} 1
+n26keychain_operations_total{service="token",operation="get",error_class="none"} 1
+n26keychain_operations_total{service="token",operation="get",error_class="not_found"} 1
+# HELP n26keychain_operation_duration_seconds Duration of the keychain storage operations.
+# TYPE n26keychain_operation_duration_seconds histogram
+n26keychain_operation_duration_seconds_bucket{service="credentials",operation="set",le="0.1"} 0
+n26keychain_operation_duration_seconds_bucket{service="credentials",operation="set",le="1"} 0
+n26keychain_operation_duration_seconds_bucket{service="credentials",operation="set",le="+Inf"} 1
+n26keychain_operation_duration_seconds_sum{service="credentials",operation="set"} 2
+n26keychain_operation_duration_seconds_count{service="credentials",operation="set"} 1
+n26keychain_operation_duration_seconds_bucket{service="svc\"\n",operation="get",le="0.1"} 1
+n26keychain_operation_duration_seconds_bucket{service="svc\"\n",operation="get",le="1"} 1
+n26keychain_operation_duration_seconds_bucket{service="svc\"\n",operation="get",le="+Inf"} 1
+n26keychain_operation_duration_seconds_sum{service="svc\"\n",operation="get"} 0
+n26keychain_operation_duration_seconds_count{service="svc\"\n",operation="get"} 1
+n26keychain_operation_duration_seconds_bucket{service="token",operation="get",le="0.1"} 1
+n26keychain_operation_duration_seconds_bucket{service="token",operation="get",le="1"} 2
+n26keychain_operation_duration_seconds_bucket{service="token",operation="get",le="+Inf"} 2
+n26keychain_operation_duration_seconds_sum{service="token",operation="get"} 0.55
+n26keychain_operation_duration_seconds_count{service="token",operation="get"} 2
+`
+
+	assert.Equal(t, expected, sb.String())
+	assert.Equal(t, int64(len(expected)), n)
+}
+
+func TestPrometheusMetrics_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewPrometheusMetrics(n26keychain.WithPrometheusNamespace("app"))
+	s := n26keychain.NewMetricsStorage(n26keychain.NewMemoryStorage(), "token", m)
+
+	_, _ = s.Get("foo") //nolint: errcheck
+
+	rec := httptest.NewRecorder()
+
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `app_operations_total{service="token",operation="get",error_class="not_found"} 1`)
+	assert.Contains(t, rec.Body.String(), `app_operation_duration_seconds_count{service="token",operation="get"} 1`)
+}
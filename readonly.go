@@ -0,0 +1,95 @@
+package n26keychain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly indicates that the storage does not allow changes.
+var ErrReadOnly = errors.New("storage is read-only")
+
+var (
+	_ Storage        = (*readOnlyStorage)(nil)
+	_ StorageContext = (*readOnlyStorage)(nil)
+	_ Lister         = (*readOnlyStorage)(nil)
+	_ Notifier       = (*readOnlyStorage)(nil)
+	_ Versioned      = (*readOnlyStorage)(nil)
+	_ HistoryKeeper  = (*readOnlyStorage)(nil)
+)
+
+type readOnlyStorage struct {
+	storage StorageContext
+}
+
+// Set returns ErrReadOnly.
+func (s *readOnlyStorage) Set(user, _ string) error {
+	return readOnlyError("set", user)
+}
+
+// SetContext returns ErrReadOnly.
+func (s *readOnlyStorage) SetContext(_ context.Context, user, _ string) error {
+	return readOnlyError("set", user)
+}
+
+// Get gets password from the underlying storage.
+func (s *readOnlyStorage) Get(user string) (string, error) {
+	return s.storage.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage.
+func (s *readOnlyStorage) GetContext(ctx context.Context, user string) (string, error) {
+	return s.storage.GetContext(ctx, user)
+}
+
+// Delete returns ErrReadOnly.
+func (s *readOnlyStorage) Delete(user string) error {
+	return readOnlyError("delete", user)
+}
+
+// DeleteContext returns ErrReadOnly.
+func (s *readOnlyStorage) DeleteContext(_ context.Context, user string) error {
+	return readOnlyError("delete", user)
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *readOnlyStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *readOnlyStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions.
+func (s *readOnlyStorage) GetVersion(user string) (string, string, error) {
+	return GetVersion(FromStorageContext(s.storage), user)
+}
+
+// SetIfMatch returns ErrReadOnly.
+func (s *readOnlyStorage) SetIfMatch(user, _, _ string) (string, error) {
+	return "", readOnlyError("set", user)
+}
+
+// History returns the versions of the key, if the underlying storage keeps them.
+func (s *readOnlyStorage) History(user string) ([]HistoryEntry, error) {
+	return History(FromStorageContext(s.storage), user)
+}
+
+// Rollback returns ErrReadOnly.
+func (s *readOnlyStorage) Rollback(user string, _ int) error {
+	return readOnlyError("rollback", user)
+}
+
+// NewReadOnlyStorage creates a storage that reads from the underlying storage but never changes it, for example for
+// reporting jobs. Set, Delete, SetIfMatch and Rollback return ErrReadOnly without calling the underlying storage.
+func NewReadOnlyStorage(storage Storage) Storage {
+	return &readOnlyStorage{
+		storage: ToStorageContext(storage),
+	}
+}
+
+func readOnlyError(op, user string) error {
+	return fmt.Errorf("%w: could not %s %q", ErrReadOnly, op, user)
+}
@@ -0,0 +1,91 @@
+package n26keychain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestReadOnlyStorage(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewReadOnlyStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("bar", nil).Once()
+	})(t))
+
+	password, err := s.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", password)
+
+	err = s.Set("foo", "baz")
+
+	assert.ErrorIs(t, err, n26keychain.ErrReadOnly)
+	assert.EqualError(t, err, `storage is read-only: could not set "foo"`)
+
+	err = n26keychain.ToStorageContext(s).DeleteContext(context.Background(), "foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrReadOnly)
+	assert.EqualError(t, err, `storage is read-only: could not delete "foo"`)
+}
+
+func TestReadOnlyStorage_Capabilities(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+
+	require.NoError(t, m.Set("foo", "bar"))
+
+	keys, err := n26keychain.Keys(n26keychain.NewReadOnlyStorage(m))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"foo"}, keys)
+
+	s := n26keychain.NewReadOnlyStorage(n26keychain.NewVersionedStorage(m))
+
+	password, version, err := n26keychain.GetVersion(s, "foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", password)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", version, "baz")
+
+	assert.ErrorIs(t, err, n26keychain.ErrReadOnly)
+
+	s = n26keychain.NewReadOnlyStorage(n26keychain.NewHistoryStorage(m, 0))
+
+	history, err := n26keychain.History(s, "foo")
+	require.NoError(t, err)
+
+	assert.Empty(t, history)
+
+	err = n26keychain.Rollback(s, "foo", 1)
+
+	assert.ErrorIs(t, err, n26keychain.ErrReadOnly)
+
+	// Nothing was changed.
+	password, err = m.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", password)
+}
+
+func TestCircuitBreakerStorage_ReadOnly(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewCircuitBreakerStorage(n26keychain.NewReadOnlyStorage(n26keychain.NewMemoryStorage()),
+		n26keychain.WithCircuitFailureThreshold(1),
+	)
+
+	assert.ErrorIs(t, s.Set("foo", "bar"), n26keychain.ErrReadOnly)
+
+	state, ok := n26keychain.CircuitStateOf(s)
+	require.True(t, ok)
+
+	assert.Equal(t, n26keychain.CircuitClosed, state)
+}
@@ -0,0 +1,210 @@
+package n26keychain
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultRetryAttempts is the maximum number of attempts of an operation.
+	DefaultRetryAttempts = 3
+	// DefaultRetryMinDelay is the delay before the first retry.
+	DefaultRetryMinDelay = 100 * time.Millisecond
+	// DefaultRetryMaxDelay is the maximum delay between two attempts.
+	DefaultRetryMaxDelay = 2 * time.Second
+	// DefaultRetryJitter is the maximum random delay that is added to the delay between two attempts.
+	DefaultRetryJitter = 100 * time.Millisecond
+)
+
+var (
+	_ Storage        = (*retryStorage)(nil)
+	_ StorageContext = (*retryStorage)(nil)
+	_ Lister         = (*retryStorage)(nil)
+	_ Notifier       = (*retryStorage)(nil)
+	_ Versioned      = (*retryStorage)(nil)
+	_ HistoryKeeper  = (*retryStorage)(nil)
+)
+
+// RetryStorageOption configures the retry storage.
+type RetryStorageOption func(s *retryStorage)
+
+type retryStorage struct {
+	storage StorageContext
+
+	attempts  int
+	minDelay  time.Duration
+	maxDelay  time.Duration
+	jitter    time.Duration
+	retryable func(err error) bool
+}
+
+// Set sets password in the underlying storage, retrying on transient errors.
+func (s *retryStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage, retrying on transient errors.
+func (s *retryStorage) SetContext(ctx context.Context, user, password string) error {
+	return s.retry(ctx, func() error {
+		return s.storage.SetContext(ctx, user, password)
+	})
+}
+
+// Get gets password from the underlying storage, retrying on transient errors.
+func (s *retryStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage, retrying on transient errors.
+func (s *retryStorage) GetContext(ctx context.Context, user string) (string, error) {
+	var password string
+
+	err := s.retry(ctx, func() error {
+		var err error
+
+		password, err = s.storage.GetContext(ctx, user)
+
+		return err
+	})
+
+	return password, err
+}
+
+// Delete deletes secret from the underlying storage, retrying on transient errors.
+func (s *retryStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage, retrying on transient errors.
+func (s *retryStorage) DeleteContext(ctx context.Context, user string) error {
+	return s.retry(ctx, func() error {
+		return s.storage.DeleteContext(ctx, user)
+	})
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *retryStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *retryStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions.
+func (s *retryStorage) GetVersion(user string) (string, string, error) {
+	return GetVersion(FromStorageContext(s.storage), user)
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions. It is not retried.
+func (s *retryStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	return SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+}
+
+// History returns the versions of the key, if the underlying storage keeps them.
+func (s *retryStorage) History(user string) ([]HistoryEntry, error) {
+	return History(FromStorageContext(s.storage), user)
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history. It is not
+// retried.
+func (s *retryStorage) Rollback(user string, version int) error {
+	return Rollback(FromStorageContext(s.storage), user, version)
+}
+
+// retry calls the operation until it succeeds, fails with an error that is not retryable, runs out of attempts or the
+// context is done.
+func (s *retryStorage) retry(ctx context.Context, op func() error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = op(); err == nil || !s.retryable(err) || attempt >= s.attempts {
+			return err
+		}
+
+		timer := time.NewTimer(s.delay(attempt))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the delay after the failed attempt. It doubles after every attempt, from the min delay up to the max
+// delay, plus a random jitter.
+func (s *retryStorage) delay(attempt int) time.Duration {
+	d := s.minDelay
+
+	for i := 1; i < attempt && d < s.maxDelay; i++ {
+		d *= 2
+	}
+
+	if d > s.maxDelay {
+		d = s.maxDelay
+	}
+
+	if s.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(s.jitter))) //nolint: gosec
+	}
+
+	return d
+}
+
+// NewRetryStorage creates a storage that retries the operations of the underlying storage when they fail with a
+// transient error, see IsRetryable, with an exponential backoff. The waiting stops when the context is done.
+func NewRetryStorage(storage Storage, options ...RetryStorageOption) Storage {
+	s := &retryStorage{
+		storage:   ToStorageContext(storage),
+		attempts:  DefaultRetryAttempts,
+		minDelay:  DefaultRetryMinDelay,
+		maxDelay:  DefaultRetryMaxDelay,
+		jitter:    DefaultRetryJitter,
+		retryable: IsRetryable,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithRetryAttempts sets the maximum number of attempts of an operation, including the first one.
+func WithRetryAttempts(attempts int) RetryStorageOption {
+	return func(s *retryStorage) {
+		s.attempts = attempts
+	}
+}
+
+// WithRetryBackoff sets the delays between two attempts. The delay doubles after every attempt, from minDelay up to
+// maxDelay.
+func WithRetryBackoff(minDelay, maxDelay time.Duration) RetryStorageOption {
+	return func(s *retryStorage) {
+		s.minDelay = minDelay
+		s.maxDelay = maxDelay
+	}
+}
+
+// WithRetryJitter sets the maximum random delay that is added to the delay between two attempts, so the processes that
+// fail at the same time do not retry at once.
+func WithRetryJitter(jitter time.Duration) RetryStorageOption {
+	return func(s *retryStorage) {
+		s.jitter = jitter
+	}
+}
+
+// WithRetryable sets the function that checks whether an error is transient, instead of IsRetryable.
+func WithRetryable(retryable func(err error) bool) RetryStorageOption {
+	return func(s *retryStorage) {
+		s.retryable = retryable
+	}
+}
@@ -0,0 +1,121 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestRetryStorage_Get(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewRetryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("", n26keychain.ErrUnavailable).Twice()
+		s.On("Get", "foo").Return("bar", nil).Once()
+	})(t), n26keychain.WithRetryBackoff(time.Millisecond, time.Millisecond), n26keychain.WithRetryJitter(0))
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "bar", data)
+	assert.NoError(t, err)
+}
+
+func TestRetryStorage_MaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewRetryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "bar").Return(n26keychain.ErrUnavailable).Times(4)
+	})(t),
+		n26keychain.WithRetryAttempts(4),
+		n26keychain.WithRetryBackoff(time.Millisecond, 2*time.Millisecond),
+		n26keychain.WithRetryJitter(time.Millisecond),
+	)
+
+	err := s.Set("foo", "bar")
+
+	assert.ErrorIs(t, err, n26keychain.ErrUnavailable)
+}
+
+func TestRetryStorage_NotRetryable(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewRetryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("", keyring.ErrNotFound).Once()
+		s.On("Delete", "foo").Return(keyring.ErrUnsupportedPlatform).Once()
+	})(t), n26keychain.WithRetryBackoff(time.Millisecond, time.Millisecond))
+
+	_, err := s.Get("foo")
+
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+
+	err = s.Delete("foo")
+
+	assert.ErrorIs(t, err, keyring.ErrUnsupportedPlatform)
+}
+
+func TestRetryStorage_Retryable(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewRetryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("", keyring.ErrNotFound).Once()
+		s.On("Get", "foo").Return("bar", nil).Once()
+	})(t),
+		n26keychain.WithRetryBackoff(time.Millisecond, time.Millisecond),
+		n26keychain.WithRetryable(func(err error) bool {
+			return errors.Is(err, keyring.ErrNotFound)
+		}),
+	)
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "bar", data)
+	assert.NoError(t, err)
+}
+
+func TestRetryStorage_ContextDone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	s := n26keychain.ToStorageContext(n26keychain.NewRetryStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("", n26keychain.ErrUnavailable).Once()
+	})(t), n26keychain.WithRetryBackoff(time.Hour, time.Hour)))
+
+	_, err := s.GetContext(ctx, "foo")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, n26keychain.ErrUnavailable)
+}
+
+func TestRetryStorage_Forward(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewRetryStorage(n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0))
+
+	require.NoError(t, s.Set("foo", "1"))
+	require.NoError(t, s.Set("foo", "2"))
+	require.NoError(t, n26keychain.Rollback(s, "foo", 1))
+
+	data, err := s.Get("foo")
+
+	assert.Equal(t, "1", data)
+	assert.NoError(t, err)
+
+	keys, err := n26keychain.Keys(s)
+
+	assert.Equal(t, []string{"foo"}, keys)
+	assert.NoError(t, err)
+
+	_, _, err = n26keychain.GetVersion(s, "foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrVersionNotSupported)
+}
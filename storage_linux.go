@@ -0,0 +1,62 @@
+package n26keychain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const secretCollectionInterface = "org.freedesktop.Secret.Collection"
+
+var _ Notifier = (*storage)(nil)
+
+// Notify notifies about the changes of the items of the Secret Service. The service is not filtered, so any change
+// triggers a notification.
+func (s *storage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, err.Error())
+	}
+
+	if err := conn.AddMatchSignalContext(ctx, dbus.WithMatchInterface(secretCollectionInterface)); err != nil {
+		_ = conn.Close() //nolint: errcheck
+
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, err.Error())
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	result := make(chan struct{}, 1)
+
+	conn.Signal(signals)
+
+	go func() {
+		defer close(result)
+		defer conn.Close() //nolint: errcheck
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case signal, ok := <-signals:
+				if !ok {
+					return
+				}
+
+				// ItemCreated, ItemChanged and ItemDeleted.
+				if !strings.HasPrefix(signal.Name, secretCollectionInterface+".Item") {
+					continue
+				}
+
+				select {
+				case result <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return result, nil
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"sync"
+	"time"
+
+	"go.nhat.io/clock"
+)
+
+var _ clock.Clock = (*Clock)(nil)
+
+// Clock is a clock that only moves when it is told to.
+type Clock struct {
+	mu        sync.Mutex
+	timestamp time.Time
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.timestamp
+}
+
+// Add moves the clock forward.
+func (c *Clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timestamp = c.timestamp.Add(d)
+}
+
+// NewClock creates a clock that starts at 2020-01-02 03:04:05 UTC.
+func NewClock() *Clock {
+	return &Clock{timestamp: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var _ trace.TracerProvider = (*TracerProvider)(nil)
+
+// RecordedSpan is a span that is ended.
+type RecordedSpan struct {
+	Name       string
+	Parent     trace.SpanID
+	ID         trace.SpanID
+	Attributes map[attribute.Key]string
+	Status     codes.Code
+	Errors     []error
+}
+
+// TracerProvider records the ended spans in memory.
+type TracerProvider struct {
+	noop.TracerProvider
+
+	mu    sync.Mutex
+	spans []RecordedSpan
+	next  uint64
+}
+
+// Tracer returns a tracer that records the spans in the provider.
+func (p *TracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &tracer{provider: p}
+}
+
+// Spans returns the ended spans, in the order they are ended.
+func (p *TracerProvider) Spans() []RecordedSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]RecordedSpan(nil), p.spans...)
+}
+
+func (p *TracerProvider) newSpanContext() trace.SpanContext {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+
+	var id trace.SpanID
+
+	binary.BigEndian.PutUint64(id[:], p.next)
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  id,
+	})
+}
+
+func (p *TracerProvider) end(s RecordedSpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.spans = append(p.spans, s)
+}
+
+// NewTracerProvider creates a tracer provider that records the ended spans in memory.
+func NewTracerProvider() *TracerProvider {
+	return &TracerProvider{}
+}
+
+type tracer struct {
+	noop.Tracer
+
+	provider *TracerProvider
+}
+
+func (t *tracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(options...)
+	sc := t.provider.newSpanContext()
+
+	s := &span{
+		provider: t.provider,
+		sc:       sc,
+		recorded: RecordedSpan{
+			Name:       name,
+			Parent:     trace.SpanContextFromContext(ctx).SpanID(),
+			ID:         sc.SpanID(),
+			Attributes: make(map[attribute.Key]string),
+		},
+	}
+
+	s.SetAttributes(cfg.Attributes()...)
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	noop.Span
+
+	provider *TracerProvider
+	sc       trace.SpanContext
+
+	mu       sync.Mutex
+	recorded RecordedSpan
+}
+
+func (s *span) SpanContext() trace.SpanContext {
+	return s.sc
+}
+
+func (s *span) IsRecording() bool {
+	return true
+}
+
+func (s *span) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range kv {
+		s.recorded.Attributes[a.Key] = a.Value.Emit()
+	}
+}
+
+func (s *span) RecordError(err error, _ ...trace.EventOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorded.Errors = append(s.recorded.Errors, err)
+}
+
+func (s *span) SetStatus(code codes.Code, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorded.Status = code
+}
+
+func (s *span) End(...trace.SpanEndOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.provider.end(s.recorded)
+}
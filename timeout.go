@@ -0,0 +1,319 @@
+package n26keychain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultOperationTimeout is how long an operation of the storage is waited for.
+const DefaultOperationTimeout = 10 * time.Second
+
+// ErrTimeout indicates that an operation of the storage did not complete in time.
+var ErrTimeout = errors.New("storage operation timed out")
+
+var (
+	_ Storage        = (*timeoutStorage)(nil)
+	_ StorageContext = (*timeoutStorage)(nil)
+	_ Lister         = (*timeoutStorage)(nil)
+	_ Notifier       = (*timeoutStorage)(nil)
+	_ Versioned      = (*timeoutStorage)(nil)
+	_ HistoryKeeper  = (*timeoutStorage)(nil)
+)
+
+type result struct {
+	value string
+	err   error
+}
+
+// keyWrites orders the writes of a key.
+type keyWrites struct {
+	// mu serializes the writes that reach the underlying storage.
+	mu sync.Mutex
+	// issued is the generation of the last write that was called, guarded by timeoutStorage.mu.
+	issued uint64
+	// written is the generation of the last write that reached the underlying storage, guarded by mu.
+	written uint64
+	// pending is the number of writes that are not done yet, even if they were given up, guarded by timeoutStorage.mu.
+	// The entry is removed when there are none, the next write of the key does not need to be ordered.
+	pending int
+}
+
+type timeoutStorage struct {
+	storage StorageContext
+	timeout time.Duration
+
+	mu     sync.Mutex
+	writes map[string]*keyWrites
+}
+
+// Set sets password in the underlying storage, waiting until the timeout.
+func (s *timeoutStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage, waiting until the timeout or until the context is done.
+func (s *timeoutStorage) SetContext(ctx context.Context, user, password string) error {
+	return s.write(ctx, "set", user, false, func(ctx context.Context) error {
+		return s.storage.SetContext(ctx, user, password)
+	})
+}
+
+// Get gets password from the underlying storage, waiting until the timeout.
+func (s *timeoutStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage, waiting until the timeout or until the context is done.
+func (s *timeoutStorage) GetContext(ctx context.Context, user string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.run(ctx, "get", func() (string, error) {
+		return s.storage.GetContext(detach(ctx), user)
+	})
+}
+
+// Delete deletes secret from the underlying storage, waiting until the timeout.
+func (s *timeoutStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage, waiting until the timeout or until the context is done.
+func (s *timeoutStorage) DeleteContext(ctx context.Context, user string) error {
+	return s.write(ctx, "delete", user, false, func(ctx context.Context) error {
+		return s.storage.DeleteContext(ctx, user)
+	})
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing, waiting until the timeout.
+func (s *timeoutStorage) Keys() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var keys []string
+
+	_, err := s.run(ctx, "list", func() (string, error) {
+		var err error
+
+		keys, err = listKeys(s.storage)
+
+		return "", err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *timeoutStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions, waiting until the timeout.
+func (s *timeoutStorage) GetVersion(user string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var version string
+
+	password, err := s.run(ctx, "get", func() (string, error) {
+		var (
+			password string
+			err      error
+		)
+
+		password, version, err = GetVersion(FromStorageContext(s.storage), user)
+
+		return password, err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return password, version, nil
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions, waiting until the timeout. It is ordered with the other writes of the key.
+func (s *timeoutStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	var version string
+
+	err := s.write(context.Background(), "set", user, true, func(context.Context) error {
+		var err error
+
+		version, err = SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// History returns the versions of the key, if the underlying storage keeps them, waiting until the timeout.
+func (s *timeoutStorage) History(user string) ([]HistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var entries []HistoryEntry
+
+	_, err := s.run(ctx, "history", func() (string, error) {
+		var err error
+
+		entries, err = History(FromStorageContext(s.storage), user)
+
+		return "", err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history, waiting
+// until the timeout. It is ordered with the other writes of the key.
+func (s *timeoutStorage) Rollback(user string, version int) error {
+	return s.write(context.Background(), "rollback", user, false, func(context.Context) error {
+		return Rollback(FromStorageContext(s.storage), user, version)
+	})
+}
+
+// write runs a write of the key with the timeout. The writes of a key reach the underlying storage one at a time and
+// in the order they were called: a write that was given up is not run, and a write is skipped if a newer one already
+// reached the storage, as if it was overwritten right away. A conditional write is never skipped, it checks the version
+// itself.
+func (s *timeoutStorage) write(
+	ctx context.Context,
+	op, user string,
+	conditional bool,
+	fn func(ctx context.Context) error,
+) error {
+	s.mu.Lock()
+
+	kw, ok := s.writes[user]
+	if !ok {
+		kw = &keyWrites{}
+		s.writes[user] = kw
+	}
+
+	kw.issued++
+	kw.pending++
+	generation := kw.issued
+
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.run(ctx, op, func() (string, error) {
+		defer s.done(user, kw)
+
+		kw.mu.Lock()
+		defer kw.mu.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if generation < kw.written && !conditional {
+			return "", nil
+		}
+
+		// The write must not be abandoned by the underlying storage, so the next write of the key waits for it.
+		if err := fn(detach(ctx)); err != nil {
+			return "", err
+		}
+
+		if generation > kw.written {
+			kw.written = generation
+		}
+
+		return "", nil
+	})
+
+	return err
+}
+
+// done marks a write of the key as done, and forgets the key when no other write of it is pending.
+func (s *timeoutStorage) done(user string, kw *keyWrites) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kw.pending--
+
+	if kw.pending == 0 {
+		delete(s.writes, user)
+	}
+}
+
+// run runs the operation in background and waits for it until the context is done. The operation keeps running after
+// that, but its result is discarded.
+func (s *timeoutStorage) run(ctx context.Context, op string, fn func() (string, error)) (string, error) {
+	done := make(chan result, 1)
+
+	go func() {
+		value, err := fn()
+
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w: %s: %w", ErrTimeout, op, ctx.Err())
+		}
+
+		return "", ctx.Err()
+	}
+}
+
+// NewTimeoutStorage creates a storage that gives up the operations of the underlying storage that take longer than the
+// timeout, for example when the keyring waits for an unlock prompt, and returns ErrTimeout. DefaultOperationTimeout is
+// used if the timeout is not positive.
+//
+// A write that is given up may still complete later, but it never overwrites a value that was written afterwards: the
+// writes of a key reach the underlying storage in the order they were called.
+func NewTimeoutStorage(storage Storage, timeout time.Duration) Storage {
+	if timeout <= 0 {
+		timeout = DefaultOperationTimeout
+	}
+
+	return &timeoutStorage{
+		storage: ToStorageContext(storage),
+		timeout: timeout,
+		writes:  make(map[string]*keyWrites),
+	}
+}
+
+// detachedContext keeps the values of a context without its deadline and its cancellation.
+type detachedContext struct {
+	context.Context //nolint: containedctx
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// detach returns a context with the values of the context, that is never done.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{Context: ctx}
+}
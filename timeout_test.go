@@ -0,0 +1,332 @@
+package n26keychain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestTimeoutStorage(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewTimeoutStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "bar").Return(nil).Once()
+		s.On("Get", "foo").Return("bar", nil).Once()
+		s.On("Delete", "foo").Return(nil).Once()
+		s.On("Get", "foo").Return("", keyring.ErrNotFound).Once()
+	})(t), time.Second)
+
+	require.NoError(t, s.Set("foo", "bar"))
+
+	password, err := s.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", password)
+
+	require.NoError(t, s.Delete("foo"))
+
+	_, err = s.Get("foo")
+	require.ErrorIs(t, err, keyring.ErrNotFound)
+}
+
+func TestTimeoutStorage_Timeout(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan time.Time)
+
+	defer close(block)
+
+	s := n26keychain.NewTimeoutStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").WaitUntil(block).Return("bar", nil).Once()
+		s.On("Delete", "foo").WaitUntil(block).Return(nil).Once()
+	})(t), 20*time.Millisecond)
+
+	_, err := s.Get("foo")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	err = s.Delete("foo")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+}
+
+func TestTimeoutStorage_ContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan time.Time)
+
+	defer close(block)
+
+	s := n26keychain.ToStorageContext(n26keychain.NewTimeoutStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").WaitUntil(block).Return("bar", nil).Once()
+	})(t), time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := s.GetContext(ctx, "foo")
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, n26keychain.ErrTimeout)
+}
+
+func TestTimeoutStorage_LateSet(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+	s := &stalledStorage{
+		Storage: m,
+		value:   "old",
+		release: make(chan struct{}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ts := n26keychain.NewTimeoutStorage(s, 20*time.Millisecond)
+
+	// The keyring is stuck on the first write, which is given up.
+	err := ts.Set("foo", "old")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	<-s.started
+
+	// The newer write waits for the stuck one, and it is not overwritten when the stuck one completes.
+	result := make(chan error, 1)
+
+	go func() {
+		result <- ts.Set("foo", "new")
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(s.release)
+
+	require.NoError(t, <-result)
+	<-s.done
+
+	password, err := m.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "new", password)
+}
+
+func TestTimeoutStorage_GivenUpWriteIsNotRun(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+	s := &stalledStorage{
+		Storage: m,
+		value:   "old",
+		release: make(chan struct{}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ts := n26keychain.NewTimeoutStorage(s, 20*time.Millisecond)
+
+	err := ts.Set("foo", "old")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	// This write waits for the stuck one and is given up before it reaches the storage.
+	err = ts.Delete("foo")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	close(s.release)
+	<-s.done
+
+	require.NoError(t, ts.Set("foo", "new"))
+
+	password, err := m.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "new", password)
+}
+
+func TestTimeoutStorage_ForgetsKeys(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+	s := &stalledStorage{
+		Storage: m,
+		value:   "old",
+		release: make(chan struct{}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ts := n26keychain.NewTimeoutStorage(s, 20*time.Millisecond)
+
+	for _, key := range []string{"bar", "baz", "qux"} {
+		require.NoError(t, ts.Set(key, "value"))
+		require.NoError(t, ts.Delete(key))
+	}
+
+	assert.Equal(t, 0, n26keychain.TimeoutWrites(ts))
+
+	// The key is kept while the write that was given up is pending.
+	err := ts.Set("foo", "old")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	<-s.started
+
+	assert.Equal(t, 1, n26keychain.TimeoutWrites(ts))
+
+	close(s.release)
+	<-s.done
+
+	assert.Eventually(t, func() bool {
+		return n26keychain.TimeoutWrites(ts) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestTimeoutStorage_LateSetBeforeConditionalWrite(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+	s := &stalledStorage{
+		Storage: m,
+		value:   "old",
+		release: make(chan struct{}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ts := n26keychain.NewTimeoutStorage(s, 20*time.Millisecond)
+
+	require.NoError(t, ts.Set("foo", "first"))
+
+	_, version, err := n26keychain.GetVersion(ts, "foo")
+	require.NoError(t, err)
+
+	err = ts.Set("foo", "old")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	<-s.started
+
+	// The conditional write waits for the stuck one, so it sees that the value changed.
+	result := make(chan error, 1)
+
+	go func() {
+		_, err := n26keychain.SetIfMatch(ts, "foo", version, "new")
+
+		result <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(s.release)
+
+	require.ErrorIs(t, <-result, n26keychain.ErrConflict)
+	<-s.done
+
+	password, err := m.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "old", password)
+}
+
+func TestTimeoutStorage_LateSetBeforeRollback(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+	s := &stalledStorage{
+		Storage: m,
+		value:   "old",
+		release: make(chan struct{}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ts := n26keychain.NewTimeoutStorage(s, 20*time.Millisecond)
+
+	err := ts.Set("foo", "old")
+	require.ErrorIs(t, err, n26keychain.ErrTimeout)
+
+	<-s.started
+
+	// The rollback waits for the stuck write, and it is not overwritten when the stuck one completes.
+	result := make(chan error, 1)
+
+	go func() {
+		result <- n26keychain.Rollback(ts, "foo", 1)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(s.release)
+
+	require.NoError(t, <-result)
+	<-s.done
+
+	password, err := m.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "rolled back", password)
+}
+
+func TestTimeoutStorage_Keys(t *testing.T) {
+	t.Parallel()
+
+	m := n26keychain.NewMemoryStorage()
+
+	require.NoError(t, m.Set("foo", "bar"))
+
+	s := n26keychain.NewTimeoutStorage(m, time.Second)
+
+	keys, err := n26keychain.Keys(s)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"foo"}, keys)
+
+	_, err = n26keychain.Keys(n26keychain.NewTimeoutStorage(mock.MockStorage()(t), time.Second))
+	require.ErrorIs(t, err, n26keychain.ErrListNotSupported)
+}
+
+// stalledStorage blocks the first write of a value until it is released. The version of a value is the value itself,
+// and a rollback sets "rolled back".
+type stalledStorage struct {
+	n26keychain.Storage
+
+	value   string
+	release chan struct{}
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (s *stalledStorage) Set(user, password string) error {
+	if password != s.value {
+		return s.Storage.Set(user, password)
+	}
+
+	close(s.started)
+	<-s.release
+
+	defer close(s.done)
+
+	return s.Storage.Set(user, password)
+}
+
+func (s *stalledStorage) GetVersion(user string) (string, string, error) {
+	password, err := s.Storage.Get(user)
+
+	return password, password, err
+}
+
+func (s *stalledStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	if current, _ := s.Storage.Get(user); current != expectedVersion { //nolint: errcheck
+		return "", n26keychain.ErrConflict
+	}
+
+	return password, s.Storage.Set(user, password)
+}
+
+func (s *stalledStorage) History(string) ([]n26keychain.HistoryEntry, error) {
+	return nil, nil
+}
+
+func (s *stalledStorage) Rollback(user string, _ int) error {
+	return s.Storage.Set(user, "rolled back")
+}
@@ -0,0 +1,82 @@
+package token
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"go.nhat.io/clock"
+)
+
+// UnknownLifetime is the lifetime that LifetimeHook receives for a token without an expiry time. Such a token is kept
+// like a token that never expires, see WithExpiryCheck.
+const UnknownLifetime = time.Duration(math.MaxInt64)
+
+// LifetimeHook receives the remaining lifetime of the access token and of the refresh token that are read from
+// keychain. A negative lifetime means the token is expired, and UnknownLifetime that the token has no expiry time.
+type LifetimeHook func(ctx context.Context, key string, accessToken, refreshToken time.Duration)
+
+// checkExpiry reports the lifetime of the token, and drops it if the refresh token is expired and the expiry check is
+// enabled. A token without the expiry time of the refresh token is kept.
+func (s *Storage) checkExpiry(ctx context.Context, key string, token auth.OAuthToken) auth.OAuthToken {
+	if !s.expiryCheck && s.lifetimeHook == nil {
+		return token
+	}
+
+	now := s.clock.Now()
+
+	if s.lifetimeHook != nil {
+		s.lifetimeHook(ctx, key, lifetime(token.ExpiresAt, now), lifetime(token.RefreshExpiresAt, now))
+	}
+
+	if !s.expiryCheck || token.RefreshExpiresAt.IsZero() || token.IsRefreshable(now) {
+		return token
+	}
+
+	if s.deleteExpired {
+		// The token is dropped anyway, it is deleted again on the next read if this fails.
+		_ = s.Delete(ctx, key) //nolint: errcheck
+	}
+
+	return auth.OAuthToken{}
+}
+
+// lifetime returns the time until the expiry time, or UnknownLifetime if the expiry time is not set.
+func lifetime(expiresAt, now time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return UnknownLifetime
+	}
+
+	return expiresAt.Sub(now)
+}
+
+// WithExpiryCheck makes Storage return an empty token, like when there is no token, if the refresh token is expired,
+// so n26api logs in right away instead of trying to refresh it.
+func WithExpiryCheck() StorageOption {
+	return func(s *Storage) {
+		s.expiryCheck = true
+	}
+}
+
+// WithDeleteExpired deletes the token from keychain when its refresh token is expired. It enables WithExpiryCheck.
+func WithDeleteExpired() StorageOption {
+	return func(s *Storage) {
+		s.expiryCheck = true
+		s.deleteExpired = true
+	}
+}
+
+// WithLifetimeHook sets a hook that receives the remaining lifetime of every token read from keychain.
+func WithLifetimeHook(hook LifetimeHook) StorageOption {
+	return func(s *Storage) {
+		s.lifetimeHook = hook
+	}
+}
+
+// WithClock sets the clock of Storage.
+func WithClock(c clock.Clock) StorageOption {
+	return func(s *Storage) {
+		s.clock = c
+	}
+}
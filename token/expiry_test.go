@@ -0,0 +1,191 @@
+//go:build !integration
+
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestTokenStorage_ExpiryCheck(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		scenario      string
+		options       []StorageOption
+		token         auth.OAuthToken
+		expectedToken auth.OAuthToken
+		expectDeleted bool
+	}{
+		{
+			scenario: "refresh token is not expired",
+			options:  []StorageOption{WithExpiryCheck()},
+			token: auth.OAuthToken{
+				AccessToken:      "access",
+				ExpiresAt:        now.Add(-time.Minute),
+				RefreshExpiresAt: now.Add(time.Minute),
+			},
+			expectedToken: auth.OAuthToken{
+				AccessToken:      "access",
+				ExpiresAt:        now.Add(-time.Minute),
+				RefreshExpiresAt: now.Add(time.Minute),
+			},
+		},
+		{
+			scenario: "no refresh expiry",
+			options:  []StorageOption{WithExpiryCheck()},
+			token:    auth.OAuthToken{AccessToken: "access"},
+			expectedToken: auth.OAuthToken{
+				AccessToken: "access",
+			},
+		},
+		{
+			scenario: "refresh token is expired",
+			options:  []StorageOption{WithExpiryCheck()},
+			token: auth.OAuthToken{
+				AccessToken:      "access",
+				ExpiresAt:        now.Add(-time.Hour),
+				RefreshExpiresAt: now,
+			},
+		},
+		{
+			scenario: "refresh token is expired without check",
+			token: auth.OAuthToken{
+				AccessToken:      "access",
+				ExpiresAt:        now.Add(-time.Hour),
+				RefreshExpiresAt: now,
+			},
+			expectedToken: auth.OAuthToken{
+				AccessToken:      "access",
+				ExpiresAt:        now.Add(-time.Hour),
+				RefreshExpiresAt: now,
+			},
+		},
+		{
+			scenario: "delete expired token",
+			options:  []StorageOption{WithDeleteExpired()},
+			token: auth.OAuthToken{
+				AccessToken:      "access",
+				ExpiresAt:        now.Add(-time.Hour),
+				RefreshExpiresAt: now.Add(-time.Minute),
+			},
+			expectDeleted: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			memory := n26keychain.NewMemoryStorage()
+			options := append([]StorageOption{WithKeyring(memory), WithClock(clock.Fix(now))}, tc.options...)
+			s := NewStorage(options...)
+
+			err := s.Set(context.Background(), tokenStorageKey, tc.token)
+			require.NoError(t, err)
+
+			token, err := s.Get(context.Background(), tokenStorageKey)
+
+			assert.Equal(t, tc.expectedToken, token)
+			assert.NoError(t, err)
+
+			_, err = memory.Get(tokenStorageKey)
+
+			if tc.expectDeleted {
+				assert.ErrorIs(t, err, keyring.ErrNotFound)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTokenStorage_DeleteExpiredError(t *testing.T) {
+	t.Parallel()
+
+	storage := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", tokenStorageKey).
+			Return(`{"access_token":"access","refresh_expires_at":"2020-01-02T03:04:05Z"}`, nil)
+
+		s.On("Delete", tokenStorageKey).
+			Return(errors.New("delete error"))
+	})(t)
+
+	s := NewStorage(
+		WithKeyring(storage),
+		WithDeleteExpired(),
+		WithClock(clock.Fix(time.Date(2020, 1, 2, 4, 4, 5, 0, time.UTC))),
+	)
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+
+	assert.Empty(t, token)
+	assert.NoError(t, err)
+}
+
+func TestTokenStorage_LifetimeHook(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	type lifetime struct {
+		key          string
+		accessToken  time.Duration
+		refreshToken time.Duration
+	}
+
+	var lifetimes []lifetime
+
+	s := NewStorage(
+		WithKeyring(n26keychain.NewMemoryStorage()),
+		WithClock(clock.Fix(now)),
+		WithLifetimeHook(func(_ context.Context, key string, accessToken, refreshToken time.Duration) {
+			lifetimes = append(lifetimes, lifetime{key: key, accessToken: accessToken, refreshToken: refreshToken})
+		}),
+	)
+
+	// No token.
+	_, err := s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	err = s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{
+		AccessToken:      "access",
+		ExpiresAt:        now.Add(-time.Minute),
+		RefreshExpiresAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	_, err = s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	// The expiry time of the refresh token is unknown.
+	err = s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{
+		AccessToken: "access",
+		ExpiresAt:   now.Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	_, err = s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	expected := []lifetime{
+		{key: tokenStorageKey, accessToken: -time.Minute, refreshToken: time.Hour},
+		{key: tokenStorageKey, accessToken: time.Minute, refreshToken: UnknownLifetime},
+	}
+
+	assert.Equal(t, expected, lifetimes)
+}
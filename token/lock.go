@@ -0,0 +1,490 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+const (
+	// DefaultLockTimeout is how long a lock is waited for.
+	DefaultLockTimeout = 30 * time.Second
+	// DefaultLockRetryInterval is the interval between two attempts to acquire a lock.
+	DefaultLockRetryInterval = 50 * time.Millisecond
+	// DefaultStaleLockAge is the age after which a lock file is considered abandoned, on the platforms without flock.
+	DefaultStaleLockAge = 5 * time.Minute
+	// DefaultLockHold is how long the lock of an expired token is held until the refreshed token is persisted.
+	DefaultLockHold = 30 * time.Second
+
+	lockFileMode    = 0o600
+	lockDirMode     = 0o700
+	lockGuardSuffix = ".guard"
+	lockNonceSize   = 16
+)
+
+// ErrLockTimeout indicates that a lock could not be acquired in time.
+var ErrLockTimeout = errors.New("could not acquire lock in time")
+
+var (
+	_ Locker             = (*FileLocker)(nil)
+	_ Refresher          = (*lockedRefresher)(nil)
+	_ tokenPersister     = (*lockedRefresher)(nil)
+	_ KeychainStorage    = (*lockedStorage)(nil)
+	_ n26keychain.Lister = (*lockedStorage)(nil)
+)
+
+// Locker provides advisory locks that are shared by several processes.
+type Locker interface {
+	// Lock acquires the lock of the key, waiting until it is free. The returned function releases the lock.
+	Lock(ctx context.Context, key string) (func() error, error)
+}
+
+// FileLockerOption configures FileLocker.
+type FileLockerOption func(l *FileLocker)
+
+// FileLocker locks with lock files in a directory. The files are locked with flock where it is supported, so the lock
+// of a process that died is released by the system. Elsewhere, a lock file is created exclusively and is considered
+// abandoned after a while, see WithStaleLockAge.
+type FileLocker struct {
+	dir string
+
+	timeout       time.Duration
+	retryInterval time.Duration
+	staleAge      time.Duration
+}
+
+// Lock acquires the lock of the key, waiting until it is free, the timeout is reached or the context is done.
+func (l *FileLocker) Lock(ctx context.Context, key string) (func() error, error) {
+	if err := os.MkdirAll(l.dir, lockDirMode); err != nil {
+		return nil, fmt.Errorf("could not create lock directory: %w", err)
+	}
+
+	path := l.path(key)
+
+	var cancel context.CancelFunc
+
+	if l.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		unlock, ok, err := l.tryLock(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not acquire lock: %w", err)
+		}
+
+		if ok {
+			return unlock, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%w: %s", ErrLockTimeout, key)
+			}
+
+			return nil, ctx.Err()
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// path returns the lock file of the key. The key is hashed because it may contain characters that are not allowed in
+// file names.
+func (l *FileLocker) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(l.dir, hex.EncodeToString(sum[:])+".lock")
+}
+
+// tryLockExclusive acquires the lock by creating the lock file exclusively. A lock file that is older than the stale
+// age is removed, so the lock can be acquired at the next attempt.
+func (l *FileLocker) tryLockExclusive(path string) (func() error, bool, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, lockFileMode) //nolint: gosec
+	if err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false, err
+		}
+
+		_ = l.removeStale(path) //nolint: errcheck
+
+		return nil, false, nil
+	}
+
+	// The pid of the owner helps finding out who holds the lock, the nonce tells the lock files of the owner apart.
+	owner, err := lockOwner()
+	if err == nil {
+		_, err = f.WriteString(owner)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path) //nolint: errcheck
+
+		return nil, false, err
+	}
+
+	return func() error {
+		return l.release(path, owner)
+	}, true, nil
+}
+
+// removeStale removes the lock file if it is older than the stale age. Every removal of a lock file holds its guard, so
+// the lock file that is checked is the one that is removed, not a fresh one of another process that replaced it.
+func (l *FileLocker) removeStale(path string) error {
+	_, err := l.guard(path, func() error {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) <= l.staleAge {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+
+	return err
+}
+
+// release removes the lock file, unless it was removed as stale and another process acquired the lock since then.
+func (l *FileLocker) release(path, owner string) error {
+	for {
+		ok, err := l.guard(path, func() error {
+			data, err := os.ReadFile(path) //nolint: gosec
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+
+				return err
+			}
+
+			if string(data) != owner {
+				return nil
+			}
+
+			return os.Remove(path)
+		})
+		if err != nil || ok {
+			return err
+		}
+
+		time.Sleep(l.retryInterval)
+	}
+}
+
+// guard runs the function while holding the guard of the lock file, which is created exclusively. It returns false if
+// the guard is held by another process. The guard is only held for a moment, so a guard that is older than the stale
+// age was left by a process that died, and is removed.
+func (l *FileLocker) guard(path string, fn func() error) (bool, error) {
+	guardPath := path + lockGuardSuffix
+
+	f, err := os.OpenFile(guardPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, lockFileMode) //nolint: gosec
+	if err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+
+		if info, err := os.Stat(guardPath); err == nil && time.Since(info.ModTime()) > l.staleAge {
+			_ = os.Remove(guardPath) //nolint: errcheck
+		}
+
+		return false, nil
+	}
+
+	defer os.Remove(guardPath) //nolint: errcheck
+
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+
+	return true, fn()
+}
+
+// lockOwner returns the content of a lock file: the pid of the process and a random nonce.
+func lockOwner() (string, error) {
+	nonce := make([]byte, lockNonceSize)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("could not generate lock nonce: %w", err)
+	}
+
+	return strconv.Itoa(os.Getpid()) + " " + hex.EncodeToString(nonce), nil
+}
+
+// NewFileLocker creates a locker with the lock files in the directory, which is created if it does not exist.
+func NewFileLocker(dir string, options ...FileLockerOption) *FileLocker {
+	l := &FileLocker{
+		dir:           dir,
+		timeout:       DefaultLockTimeout,
+		retryInterval: DefaultLockRetryInterval,
+		staleAge:      DefaultStaleLockAge,
+	}
+
+	for _, o := range options {
+		o(l)
+	}
+
+	return l
+}
+
+// WithLockTimeout sets how long a lock is waited for. Zero waits until the context is done.
+func WithLockTimeout(timeout time.Duration) FileLockerOption {
+	return func(l *FileLocker) {
+		l.timeout = timeout
+	}
+}
+
+// WithLockRetryInterval sets the interval between two attempts to acquire a lock.
+func WithLockRetryInterval(interval time.Duration) FileLockerOption {
+	return func(l *FileLocker) {
+		l.retryInterval = interval
+	}
+}
+
+// WithStaleLockAge sets the age after which a lock file is considered abandoned, on the platforms without flock.
+func WithStaleLockAge(age time.Duration) FileLockerOption {
+	return func(l *FileLocker) {
+		l.staleAge = age
+	}
+}
+
+type lockedRefresher struct {
+	storage   auth.TokenStorage
+	refresher Refresher
+	locker    Locker
+}
+
+// Refresh refreshes the token and persists it while holding the lock of the key. If another process refreshed the
+// token while waiting for the lock, its token is returned instead.
+func (r *lockedRefresher) Refresh(ctx context.Context, key string, token auth.OAuthToken) (_ auth.OAuthToken, err error) {
+	unlock, err := r.locker.Lock(ctx, key)
+	if err != nil {
+		return auth.OAuthToken{}, err
+	}
+
+	defer func() {
+		if unlockErr := unlock(); err == nil && unlockErr != nil {
+			err = fmt.Errorf("could not release lock: %w", unlockErr)
+		}
+	}()
+
+	current, err := r.storage.Get(ctx, key)
+	if err != nil {
+		return auth.OAuthToken{}, err
+	}
+
+	if current.AccessToken != "" && current.AccessToken != token.AccessToken {
+		return current, nil
+	}
+
+	refreshed, err := r.refresher.Refresh(ctx, key, token)
+	if err != nil {
+		return auth.OAuthToken{}, err
+	}
+
+	if err := r.storage.Set(ctx, key, refreshed); err != nil {
+		return auth.OAuthToken{}, err
+	}
+
+	return refreshed, nil
+}
+
+// persistsToken satisfies tokenPersister, the token is persisted while holding the lock.
+func (r *lockedRefresher) persistsToken() {}
+
+// NewLockedRefresher makes a refresher refresh a token in only one process at a time. The other processes wait for the
+// lock, then use the token that is persisted in the storage instead of refreshing it again, which would invalidate the
+// refresh token of the first process.
+func NewLockedRefresher(storage auth.TokenStorage, refresher Refresher, locker Locker) Refresher {
+	return &lockedRefresher{
+		storage:   storage,
+		refresher: refresher,
+		locker:    locker,
+	}
+}
+
+// LockedStorageOption configures the locked storage.
+type LockedStorageOption func(s *lockedStorage)
+
+// heldLock is the lock of a token that is being refreshed.
+type heldLock struct {
+	unlock func() error
+	timer  *time.Timer
+}
+
+type lockedStorage struct {
+	storage KeychainStorage
+	locker  Locker
+	clock   clock.Clock
+	hold    time.Duration
+
+	mu   sync.Mutex
+	held map[string]*heldLock
+}
+
+// Get gets the token from the underlying storage. When the token is missing or expired, the lock of the key is
+// acquired and the token is read again, in case another process refreshed it while waiting for the lock. If it still
+// has to be refreshed, the lock is held until the refreshed token is persisted with Set, or until the hold timeout.
+func (s *lockedStorage) Get(ctx context.Context, key string) (auth.OAuthToken, error) {
+	token, err := s.storage.Get(ctx, key)
+	if err != nil || !s.needsRefresh(token) {
+		return token, err
+	}
+
+	s.mu.Lock()
+	_, held := s.held[key]
+	s.mu.Unlock()
+
+	// The lock is already held by this process, for example the refresh failed and is tried again.
+	if held {
+		return token, nil
+	}
+
+	unlock, err := s.locker.Lock(ctx, key)
+	if err != nil {
+		return auth.OAuthToken{}, err
+	}
+
+	token, err = s.storage.Get(ctx, key)
+	if err != nil || !s.needsRefresh(token) {
+		if unlockErr := unlock(); err == nil && unlockErr != nil {
+			err = fmt.Errorf("could not release lock: %w", unlockErr)
+		}
+
+		return token, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.held[key]; ok {
+		return token, unlock()
+	}
+
+	h := &heldLock{unlock: unlock}
+	h.timer = time.AfterFunc(s.hold, func() {
+		_ = s.release(key, h) //nolint: errcheck
+	})
+
+	s.held[key] = h
+
+	return token, nil
+}
+
+// Set persists the token to the underlying storage and releases the lock of the key, if it is held.
+func (s *lockedStorage) Set(ctx context.Context, key string, token auth.OAuthToken) error {
+	err := s.storage.Set(ctx, key, token)
+
+	if releaseErr := s.release(key, nil); err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+// Delete deletes the token in the underlying storage and releases the lock of the key, if it is held.
+func (s *lockedStorage) Delete(ctx context.Context, key string) error {
+	err := s.storage.Delete(ctx, key)
+
+	if releaseErr := s.release(key, nil); err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+// Keys returns the keys of all the tokens, if the underlying storage supports listing its keys.
+func (s *lockedStorage) Keys() ([]string, error) {
+	l, ok := s.storage.(n26keychain.Lister)
+	if !ok {
+		return nil, n26keychain.ErrListNotSupported
+	}
+
+	return l.Keys()
+}
+
+func (s *lockedStorage) needsRefresh(token auth.OAuthToken) bool {
+	return token.AccessToken == "" || token.IsExpired(s.clock.Now())
+}
+
+// release releases the lock of the key, if it is held. When h is not nil, the lock is only released if it is still
+// the held one.
+func (s *lockedStorage) release(key string, h *heldLock) error {
+	s.mu.Lock()
+
+	current, ok := s.held[key]
+	if !ok || (h != nil && current != h) {
+		s.mu.Unlock()
+
+		return nil
+	}
+
+	delete(s.held, key)
+	current.timer.Stop()
+
+	s.mu.Unlock()
+
+	if err := current.unlock(); err != nil {
+		return fmt.Errorf("could not release lock: %w", err)
+	}
+
+	return nil
+}
+
+// NewLockedStorage creates a token storage that refreshes a token in only one process at a time, for the n26 clients
+// of several processes that share the token. When a client gets a missing or expired token, it waits for the lock of
+// the key and holds it until it persists the new token, see DefaultLockHold. The other clients wait for the lock, then
+// get the persisted token instead of refreshing it again, which would invalidate the refresh token of the first one.
+//
+// The lock is held by the process: while it is held, the clients of the same process that share the storage do not
+// wait for it.
+func NewLockedStorage(storage KeychainStorage, locker Locker, options ...LockedStorageOption) KeychainStorage {
+	s := &lockedStorage{
+		storage: storage,
+		locker:  locker,
+		clock:   clock.New(),
+		hold:    DefaultLockHold,
+		held:    make(map[string]*heldLock),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithLockHold sets how long the lock of an expired token is held until the refreshed token is persisted.
+func WithLockHold(hold time.Duration) LockedStorageOption {
+	return func(s *lockedStorage) {
+		s.hold = hold
+	}
+}
+
+// WithLockClock sets the clock that tells whether a token is expired.
+func WithLockClock(c clock.Clock) LockedStorageOption {
+	return func(s *lockedStorage) {
+		s.clock = c
+	}
+}
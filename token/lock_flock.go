@@ -0,0 +1,29 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package token
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock acquires the lock with flock. Closing the file, or the end of the process, releases the lock.
+func (l *FileLocker) tryLock(path string) (func() error, bool, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, lockFileMode) //nolint: gosec
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close() //nolint: errcheck
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return f.Close, true, nil
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package token
+
+// tryLock acquires the lock by creating the lock file exclusively, flock is not supported.
+func (l *FileLocker) tryLock(path string) (func() error, bool, error) {
+	return l.tryLockExclusive(path)
+}
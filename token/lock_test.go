@@ -0,0 +1,358 @@
+//go:build !integration
+
+package token
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestFileLocker_Lock(t *testing.T) {
+	t.Parallel()
+
+	l := NewFileLocker(t.TempDir(), WithLockRetryInterval(time.Millisecond))
+
+	unlock, err := l.Lock(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	// Another key is not locked.
+	unlockOther, err := l.Lock(context.Background(), "other")
+	require.NoError(t, err)
+	require.NoError(t, unlockOther())
+
+	acquired := make(chan struct{})
+
+	go func() {
+		defer close(acquired)
+
+		unlock, err := l.Lock(context.Background(), tokenStorageKey)
+		if assert.NoError(t, err) {
+			assert.NoError(t, unlock())
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock is acquired twice")
+
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, unlock())
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock is not released")
+	}
+}
+
+func TestFileLocker_Timeout(t *testing.T) {
+	t.Parallel()
+
+	l := NewFileLocker(t.TempDir(), WithLockTimeout(20*time.Millisecond), WithLockRetryInterval(time.Millisecond))
+
+	unlock, err := l.Lock(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	defer unlock() //nolint: errcheck
+
+	_, err = l.Lock(context.Background(), tokenStorageKey)
+
+	assert.ErrorIs(t, err, ErrLockTimeout)
+
+	// Canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = NewFileLocker(l.dir, WithLockTimeout(0)).Lock(ctx, tokenStorageKey)
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFileLocker_Exclusive(t *testing.T) {
+	t.Parallel()
+
+	l := NewFileLocker(t.TempDir(), WithStaleLockAge(time.Minute))
+	path := l.path(tokenStorageKey)
+
+	require.NoError(t, os.MkdirAll(l.dir, lockDirMode))
+
+	unlock, ok, err := l.tryLockExclusive(path)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = l.tryLockExclusive(path)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, unlock())
+
+	// Stale lock.
+	staleUnlock, ok, err := l.tryLockExclusive(path)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	past := time.Now().Add(-2 * time.Minute)
+
+	require.NoError(t, os.Chtimes(path, past, past))
+
+	// The stale lock is removed, then acquired at the next attempt.
+	_, ok, err = l.tryLockExclusive(path)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	unlock, ok, err = l.tryLockExclusive(path)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The owner of the stale lock does not release the lock of the new owner.
+	require.NoError(t, staleUnlock())
+
+	_, ok, err = l.tryLockExclusive(path)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, unlock())
+
+	// A stale lock is not removed while its guard is held by another process.
+	staleUnlock, ok, err = l.tryLockExclusive(path)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, os.Chtimes(path, past, past))
+	require.NoError(t, os.WriteFile(path+lockGuardSuffix, nil, lockFileMode))
+
+	_, ok, err = l.tryLockExclusive(path)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+
+	require.NoError(t, os.Remove(path+lockGuardSuffix))
+	require.NoError(t, staleUnlock())
+}
+
+func TestLockedRefresher(t *testing.T) {
+	t.Parallel()
+
+	s := NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))
+	expired := auth.OAuthToken{AccessToken: "access", RefreshToken: "refresh"}
+
+	err := s.Set(context.Background(), tokenStorageKey, expired)
+	require.NoError(t, err)
+
+	var calls int32
+
+	refresher := RefresherFunc(func(context.Context, string, auth.OAuthToken) (auth.OAuthToken, error) {
+		atomic.AddInt32(&calls, 1)
+
+		// Give the other processes the time to wait for the lock.
+		time.Sleep(20 * time.Millisecond)
+
+		return auth.OAuthToken{AccessToken: "new-access", RefreshToken: "new-refresh"}, nil
+	})
+
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Each process has its own locker.
+			r := NewLockedRefresher(s, refresher, NewFileLocker(dir, WithLockRetryInterval(time.Millisecond)))
+
+			token, err := r.Refresh(context.Background(), tokenStorageKey, expired)
+
+			assert.Equal(t, auth.Token("new-access"), token.AccessToken)
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Equal(t, auth.Token("new-refresh"), token.RefreshToken)
+}
+
+func TestLockedRefresher_Error(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))
+
+	r := NewLockedRefresher(s,
+		RefresherFunc(func(context.Context, string, auth.OAuthToken) (auth.OAuthToken, error) {
+			return auth.OAuthToken{}, errors.New("refresh error")
+		}),
+		NewFileLocker(dir),
+	)
+
+	token, err := r.Refresh(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+
+	assert.Empty(t, token)
+	assert.EqualError(t, err, "refresh error")
+
+	// The lock is released.
+	unlock, err := NewFileLocker(dir, WithLockTimeout(time.Millisecond)).Lock(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.NoError(t, unlock())
+}
+
+func TestLockedStorage(t *testing.T) {
+	t.Parallel()
+
+	clock := test.NewClock()
+	now := clock.Now()
+
+	s := NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))
+	expired := auth.OAuthToken{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: now.Add(-time.Minute)}
+
+	err := s.Set(context.Background(), tokenStorageKey, expired)
+	require.NoError(t, err)
+
+	var calls int32
+
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Each process has its own locker and refreshes like the n26 client.
+			ls := NewLockedStorage(s, NewFileLocker(dir, WithLockRetryInterval(time.Millisecond)), WithLockClock(clock))
+
+			token, err := ls.Get(context.Background(), tokenStorageKey)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			if token.IsExpired(clock.Now()) {
+				atomic.AddInt32(&calls, 1)
+
+				// Give the other processes the time to wait for the lock.
+				time.Sleep(20 * time.Millisecond)
+
+				token = auth.OAuthToken{AccessToken: "new-access", ExpiresAt: now.Add(time.Hour)}
+
+				assert.NoError(t, ls.Set(context.Background(), tokenStorageKey, token))
+			}
+
+			assert.Equal(t, auth.Token("new-access"), token.AccessToken)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestLockedStorage_Hold(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))
+
+	first := NewLockedStorage(s, NewFileLocker(dir, WithLockRetryInterval(time.Millisecond)), WithLockHold(50*time.Millisecond))
+	second := NewLockedStorage(s, NewFileLocker(dir, WithLockRetryInterval(time.Millisecond), WithLockTimeout(time.Second)))
+
+	// The first process gets the missing token and never persists one, for example the login failed.
+	token, err := first.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Empty(t, token)
+
+	// The same process does not wait for its own lock.
+	token, err = first.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Empty(t, token)
+
+	// The lock is released after the hold timeout.
+	token, err = second.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Empty(t, token)
+
+	require.NoError(t, second.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"}))
+}
+
+func TestWithTokenStorage_Locker(t *testing.T) {
+	t.Parallel()
+
+	s := newTokenStorage(WithKeyring(n26keychain.NewMemoryStorage()), WithLocker(NewFileLocker(t.TempDir())))
+
+	assert.IsType(t, &lockedStorage{}, s)
+	assert.IsType(t, &Storage{}, newTokenStorage(WithKeyring(n26keychain.NewMemoryStorage())))
+}
+
+func TestScheduler_LockedRefresher(t *testing.T) {
+	t.Parallel()
+
+	clock := test.NewClock()
+	now := clock.Now()
+
+	storage := &countingStorage{Storage: NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))}
+
+	err := storage.Storage.Set(context.Background(), tokenStorageKey, auth.OAuthToken{
+		AccessToken:      "access",
+		ExpiresAt:        now,
+		RefreshExpiresAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	refresher := RefresherFunc(func(context.Context, string, auth.OAuthToken) (auth.OAuthToken, error) {
+		return auth.OAuthToken{AccessToken: "new-access", ExpiresAt: now.Add(time.Hour)}, nil
+	})
+
+	sc := NewScheduler(storage, NewLockedRefresher(storage, refresher, NewFileLocker(t.TempDir())),
+		WithSchedulerKeys(tokenStorageKey),
+		WithSchedulerClock(clock),
+		WithRefreshJitter(0),
+		WithCheckInterval(time.Hour),
+	)
+
+	sc.tick(context.Background())
+
+	// The token is only persisted by the refresher.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&storage.sets))
+}
+
+// countingStorage counts the tokens that are persisted.
+type countingStorage struct {
+	*Storage
+
+	sets int32
+}
+
+func (s *countingStorage) Set(ctx context.Context, key string, token auth.OAuthToken) error {
+	atomic.AddInt32(&s.sets, 1)
+
+	return s.Storage.Set(ctx, key, token)
+}
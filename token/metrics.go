@@ -0,0 +1,100 @@
+package token
+
+import (
+	"context"
+	"time"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+var (
+	_ KeychainStorage    = (*metricsStorage)(nil)
+	_ n26keychain.Lister = (*metricsStorage)(nil)
+)
+
+// MetricsStorageOption configures the metrics token storage.
+type MetricsStorageOption func(s *metricsStorage)
+
+type metricsStorage struct {
+	storage KeychainStorage
+	metrics n26keychain.Metrics
+	clock   clock.Clock
+	service string
+}
+
+// Get gets token from the underlying storage and records the operation.
+func (s *metricsStorage) Get(ctx context.Context, key string) (auth.OAuthToken, error) {
+	start := s.clock.Now()
+	token, err := s.storage.Get(ctx, key)
+
+	s.observe(n26keychain.MetricsOperationGet, start, err)
+
+	return token, err
+}
+
+// Set persists token to the underlying storage and records the operation.
+func (s *metricsStorage) Set(ctx context.Context, key string, token auth.OAuthToken) error {
+	start := s.clock.Now()
+	err := s.storage.Set(ctx, key, token)
+
+	s.observe(n26keychain.MetricsOperationSet, start, err)
+
+	return err
+}
+
+// Delete deletes the token in the underlying storage and records the operation.
+func (s *metricsStorage) Delete(ctx context.Context, key string) error {
+	start := s.clock.Now()
+	err := s.storage.Delete(ctx, key)
+
+	s.observe(n26keychain.MetricsOperationDelete, start, err)
+
+	return err
+}
+
+// Keys returns the keys of all the tokens, if the underlying storage supports listing its keys.
+func (s *metricsStorage) Keys() ([]string, error) {
+	l, ok := s.storage.(n26keychain.Lister)
+	if !ok {
+		return nil, n26keychain.ErrListNotSupported
+	}
+
+	return l.Keys()
+}
+
+func (s *metricsStorage) observe(operation string, start time.Time, err error) {
+	s.metrics.ObserveOperation(s.service, operation, n26keychain.ErrorClass(err), s.clock.Now().Sub(start))
+}
+
+// NewMetricsStorage creates a token storage that records the count, the duration and the error class of every operation
+// of the underlying storage, labeled with the service. Unlike n26keychain.NewMetricsStorage, it also sees the errors of
+// the tokens that can not be unmarshaled.
+func NewMetricsStorage(
+	storage KeychainStorage,
+	service string,
+	metrics n26keychain.Metrics,
+	options ...MetricsStorageOption,
+) KeychainStorage {
+	s := &metricsStorage{
+		storage: storage,
+		metrics: metrics,
+		clock:   clock.New(),
+		service: service,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithMetricsClock sets the clock of the metrics token storage.
+func WithMetricsClock(c clock.Clock) MetricsStorageOption {
+	return func(s *metricsStorage) {
+		s.clock = c
+	}
+}
@@ -0,0 +1,93 @@
+//go:build !integration
+
+package token
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestMetricsStorage(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	m := n26keychain.NewPrometheusMetrics()
+	s := NewMetricsStorage(NewStorage(WithKeyring(memory)), "n26api.token", m)
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	err = memory.Set(tokenStorageKey, "{")
+	require.NoError(t, err)
+
+	_, err = s.Get(context.Background(), tokenStorageKey)
+	require.Error(t, err)
+
+	err = s.Delete(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	keys, err := s.(n26keychain.Lister).Keys()
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+
+	var sb strings.Builder
+
+	_, err = m.WriteTo(&sb)
+	require.NoError(t, err)
+
+	assert.Contains(t, sb.String(), `n26keychain_operations_total{service="n26api.token",operation="delete",error_class="none"} 1`)
+	assert.Contains(t, sb.String(), `n26keychain_operations_total{service="n26api.token",operation="get",error_class="unmarshal"} 1`)
+	assert.Contains(t, sb.String(), `n26keychain_operations_total{service="n26api.token",operation="set",error_class="none"} 1`)
+}
+
+func TestMetricsStorage_Clock(t *testing.T) {
+	t.Parallel()
+
+	c := test.NewClock()
+	m := n26keychain.NewPrometheusMetrics()
+	s := NewMetricsStorage(&slowStorage{KeychainStorage: NewStorage(WithKeyring(n26keychain.NewMemoryStorage())), clock: c},
+		"n26api.token", m, WithMetricsClock(c))
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	var sb strings.Builder
+
+	_, err = m.WriteTo(&sb)
+	require.NoError(t, err)
+
+	assert.Contains(t, sb.String(), `n26keychain_operation_duration_seconds_sum{service="n26api.token",operation="set"} 2`)
+}
+
+func TestMetricsStorage_KeysNotSupported(t *testing.T) {
+	t.Parallel()
+
+	s := NewMetricsStorage(&struct{ KeychainStorage }{}, "n26api.token", n26keychain.NewPrometheusMetrics())
+
+	_, err := s.(n26keychain.Lister).Keys()
+
+	assert.ErrorIs(t, err, n26keychain.ErrListNotSupported)
+}
+
+// slowStorage takes 2 seconds of the clock to persist a token.
+type slowStorage struct {
+	KeychainStorage
+
+	clock *test.Clock
+}
+
+func (s *slowStorage) Set(ctx context.Context, key string, token auth.OAuthToken) error {
+	s.clock.Add(2 * time.Second)
+
+	return s.KeychainStorage.Set(ctx, key, token)
+}
@@ -0,0 +1,353 @@
+package token
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bool64/ctxd"
+	"github.com/nhatthm/n26api/pkg/auth"
+	"go.nhat.io/clock"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+const (
+	// DefaultRefreshBefore is how long before the expiry a token is refreshed.
+	DefaultRefreshBefore = time.Minute
+	// DefaultRefreshJitter is the maximum random delay that is added to the refresh time of a token.
+	DefaultRefreshJitter = 10 * time.Second
+	// DefaultCheckInterval is the interval between two reads of the tokens in the storage.
+	DefaultCheckInterval = time.Minute
+)
+
+// Refresher refreshes a token, for example with the refresh flow of the N26 API.
+type Refresher interface {
+	// Refresh returns a new token for the given one.
+	Refresh(ctx context.Context, key string, token auth.OAuthToken) (auth.OAuthToken, error)
+}
+
+// tokenPersister is a Refresher that persists the refreshed token itself, so Scheduler does not persist it again.
+type tokenPersister interface {
+	persistsToken()
+}
+
+// RefresherFunc is an inline Refresher.
+type RefresherFunc func(ctx context.Context, key string, token auth.OAuthToken) (auth.OAuthToken, error)
+
+// Refresh satisfies Refresher.
+func (f RefresherFunc) Refresh(ctx context.Context, key string, token auth.OAuthToken) (auth.OAuthToken, error) {
+	return f(ctx, key, token)
+}
+
+// SchedulerOption configures Scheduler.
+type SchedulerOption func(s *Scheduler)
+
+type refreshState struct {
+	expiresAt time.Time
+	dueAt     time.Time
+	attempts  int
+}
+
+// Scheduler refreshes the stored tokens in background shortly before they expire, so they are still valid when they
+// are used.
+type Scheduler struct {
+	storage   auth.TokenStorage
+	refresher Refresher
+	clock     clock.Clock
+	logger    ctxd.Logger
+
+	keys []string
+
+	before        time.Duration
+	jitter        time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	checkInterval time.Duration
+
+	states map[string]*refreshState
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start starts refreshing the tokens in background, until the context is done or the scheduler is stopped. It does
+// nothing if the scheduler is already started.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	go s.run(ctx, s.done)
+}
+
+// Stop stops the scheduler and waits for the running refresh to finish. The scheduler can be started again.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.done
+
+	s.cancel = nil
+	s.done = nil
+}
+
+func (s *Scheduler) run(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		next := s.tick(ctx)
+		timer := time.NewTimer(next.Sub(s.clock.Now()))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+
+		case <-timer.C:
+		}
+	}
+}
+
+// tick refreshes the tokens that are due and returns when it should run again.
+func (s *Scheduler) tick(ctx context.Context) time.Time {
+	now := s.clock.Now()
+	next := now.Add(s.checkInterval)
+
+	keys, err := s.listKeys()
+	if err != nil {
+		s.logger.Error(ctx, "could not list tokens", "error", err)
+
+		return next
+	}
+
+	seen := make(map[string]struct{}, len(keys))
+
+	for _, key := range keys {
+		seen[key] = struct{}{}
+
+		if dueAt, ok := s.refresh(ctx, key, now); ok && dueAt.Before(next) {
+			next = dueAt
+		}
+	}
+
+	for key := range s.states {
+		if _, ok := seen[key]; !ok {
+			delete(s.states, key)
+		}
+	}
+
+	return next
+}
+
+// refresh refreshes the token if it is due, and returns when it is due next. It returns false if the token can not be
+// refreshed.
+func (s *Scheduler) refresh(ctx context.Context, key string, now time.Time) (time.Time, bool) {
+	token, err := s.storage.Get(ctx, key)
+	if err != nil {
+		s.logger.Error(ctx, "could not get token", "error", err, "key", key)
+
+		return time.Time{}, false
+	}
+
+	st := s.state(key, token)
+	if st == nil || !token.IsRefreshable(now) {
+		delete(s.states, key)
+
+		return time.Time{}, false
+	}
+
+	if now.Before(st.dueAt) {
+		return st.dueAt, true
+	}
+
+	refreshed, err := s.refresher.Refresh(ctx, key, token)
+	if _, persisted := s.refresher.(tokenPersister); err == nil && !persisted {
+		err = s.storage.Set(ctx, key, refreshed)
+	}
+
+	if err != nil {
+		st.attempts++
+		st.dueAt = now.Add(s.backoff(st.attempts))
+
+		s.logger.Error(ctx, "could not refresh token", "error", err, "key", key, "attempts", st.attempts)
+
+		return st.dueAt, true
+	}
+
+	delete(s.states, key)
+
+	st = s.state(key, refreshed)
+	if st == nil {
+		return time.Time{}, false
+	}
+
+	// The new token is not refreshed again right away, even if it expires soon.
+	if minDueAt := now.Add(s.minBackoff); st.dueAt.Before(minDueAt) {
+		st.dueAt = minDueAt
+	}
+
+	return st.dueAt, true
+}
+
+// state returns the refresh state of the token, or nil if the token does not expire. The state is reset when the token
+// changes.
+func (s *Scheduler) state(key string, token auth.OAuthToken) *refreshState {
+	expiresAt := expiryOf(token)
+	if expiresAt.IsZero() {
+		return nil
+	}
+
+	if st, ok := s.states[key]; ok && st.expiresAt.Equal(expiresAt) {
+		return st
+	}
+
+	st := &refreshState{
+		expiresAt: expiresAt,
+		dueAt:     expiresAt.Add(-s.before - s.randomJitter()),
+	}
+
+	s.states[key] = st
+
+	return st
+}
+
+func (s *Scheduler) listKeys() ([]string, error) {
+	if s.keys != nil {
+		return s.keys, nil
+	}
+
+	l, ok := s.storage.(n26keychain.Lister)
+	if !ok {
+		return nil, n26keychain.ErrListNotSupported
+	}
+
+	return l.Keys()
+}
+
+func (s *Scheduler) backoff(attempts int) time.Duration {
+	d := s.minBackoff
+
+	for i := 1; i < attempts && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > s.maxBackoff {
+		return s.maxBackoff
+	}
+
+	return d
+}
+
+func (s *Scheduler) randomJitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(s.jitter))) //nolint: gosec
+}
+
+// expiryOf returns the earliest expiry of the access token and the refresh token, ignoring the unknown ones.
+func expiryOf(token auth.OAuthToken) time.Time {
+	switch {
+	case token.ExpiresAt.IsZero():
+		return token.RefreshExpiresAt
+
+	case token.RefreshExpiresAt.IsZero(), token.ExpiresAt.Before(token.RefreshExpiresAt):
+		return token.ExpiresAt
+	}
+
+	return token.RefreshExpiresAt
+}
+
+// NewScheduler creates a scheduler that refreshes the tokens of the storage with the refresher. The tokens are listed
+// from the storage, see WithSchedulerKeys if the storage can not list them.
+func NewScheduler(storage auth.TokenStorage, refresher Refresher, options ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		storage:   storage,
+		refresher: refresher,
+		clock:     clock.New(),
+		logger:    ctxd.NoOpLogger{},
+
+		before:        DefaultRefreshBefore,
+		jitter:        DefaultRefreshJitter,
+		minBackoff:    time.Second,
+		maxBackoff:    5 * time.Minute,
+		checkInterval: DefaultCheckInterval,
+
+		states: make(map[string]*refreshState),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithSchedulerKeys sets the keys of the tokens to refresh, instead of listing them from the storage.
+func WithSchedulerKeys(keys ...string) SchedulerOption {
+	return func(s *Scheduler) {
+		s.keys = keys
+	}
+}
+
+// WithRefreshBefore sets how long before the expiry a token is refreshed.
+func WithRefreshBefore(d time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.before = d
+	}
+}
+
+// WithRefreshJitter sets the maximum random delay that is added to the refresh time of a token, so the tokens that
+// expire at the same time are not refreshed at once.
+func WithRefreshJitter(d time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.jitter = d
+	}
+}
+
+// WithRefreshBackoff sets the delays between two failed refreshes of a token. The delay doubles after every failure,
+// from minDelay up to maxDelay.
+func WithRefreshBackoff(minDelay, maxDelay time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.minBackoff = minDelay
+		s.maxBackoff = maxDelay
+	}
+}
+
+// WithCheckInterval sets the interval between two reads of the tokens in the storage, to find the new tokens and the
+// tokens that are changed by other processes.
+func WithCheckInterval(d time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.checkInterval = d
+	}
+}
+
+// WithSchedulerClock sets the clock of Scheduler.
+func WithSchedulerClock(c clock.Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithSchedulerLogger sets logger for Scheduler.
+func WithSchedulerLogger(logger ctxd.Logger) SchedulerOption {
+	return func(s *Scheduler) {
+		s.logger = logger
+	}
+}
@@ -0,0 +1,235 @@
+//go:build !integration
+
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bool64/ctxd"
+	"github.com/nhatthm/n26api/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestScheduler_Refresh(t *testing.T) {
+	t.Parallel()
+
+	clock := test.NewClock()
+	now := clock.Now()
+	s := NewStorage(WithKeyring(n26keychain.NewIndexedStorage(n26keychain.NewMemoryStorage())))
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{
+		AccessToken:      "access",
+		RefreshToken:     "refresh",
+		ExpiresAt:        now.Add(10 * time.Minute),
+		RefreshExpiresAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	var calls []auth.OAuthToken
+
+	refresher := RefresherFunc(func(_ context.Context, key string, token auth.OAuthToken) (auth.OAuthToken, error) {
+		assert.Equal(t, tokenStorageKey, key)
+
+		calls = append(calls, token)
+
+		return auth.OAuthToken{
+			AccessToken:      "new-access",
+			RefreshToken:     "new-refresh",
+			ExpiresAt:        clock.Now().Add(15 * time.Minute),
+			RefreshExpiresAt: clock.Now().Add(time.Hour),
+		}, nil
+	})
+
+	sc := NewScheduler(s, refresher,
+		WithSchedulerClock(clock),
+		WithRefreshJitter(0),
+		WithCheckInterval(time.Hour),
+	)
+
+	// Not due yet.
+	assert.Equal(t, now.Add(9*time.Minute), sc.tick(context.Background()))
+	assert.Empty(t, calls)
+
+	// Due.
+	clock.Add(9 * time.Minute)
+
+	assert.Equal(t, now.Add(23*time.Minute), sc.tick(context.Background()))
+	assert.Len(t, calls, 1)
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Equal(t, auth.Token("new-access"), token.AccessToken)
+
+	// The new token is not refreshed again.
+	assert.Equal(t, now.Add(23*time.Minute), sc.tick(context.Background()))
+	assert.Len(t, calls, 1)
+}
+
+func TestScheduler_Backoff(t *testing.T) {
+	t.Parallel()
+
+	clock := test.NewClock()
+	now := clock.Now()
+
+	s := NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{
+		AccessToken:      "access",
+		ExpiresAt:        now,
+		RefreshExpiresAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	l := &ctxd.LoggerMock{}
+
+	sc := NewScheduler(s,
+		RefresherFunc(func(context.Context, string, auth.OAuthToken) (auth.OAuthToken, error) {
+			return auth.OAuthToken{}, errors.New("refresh error")
+		}),
+		WithSchedulerKeys(tokenStorageKey),
+		WithSchedulerClock(clock),
+		WithSchedulerLogger(l),
+		WithRefreshJitter(0),
+		WithRefreshBackoff(time.Second, 3*time.Second),
+		WithCheckInterval(time.Hour),
+	)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+
+	for _, d := range expected {
+		assert.Equal(t, clock.Now().Add(d), sc.tick(context.Background()))
+
+		clock.Add(d)
+	}
+
+	assert.Contains(t, l.String(), `error: could not refresh token {"attempts":4,"error":{},"key":"`+tokenStorageKey+`"}`)
+}
+
+func TestScheduler_Skip(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		scenario       string
+		mockStorage    mock.StorageMocker
+		expectedLog    string
+		withoutListing bool
+	}{
+		{
+			scenario: "no token",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", tokenStorageKey).Return(`{}`, nil)
+			}),
+		},
+		{
+			scenario: "refresh token is expired",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", tokenStorageKey).
+					Return(`{"access_token":"access","expires_at":"2020-01-02T03:04:05Z","refresh_expires_at":"2020-01-02T03:04:05Z"}`, nil)
+			}),
+		},
+		{
+			scenario: "could not get token",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", tokenStorageKey).Return("", errors.New("get error"))
+			}),
+			expectedLog: `error: could not get token {"error":{},"key":"` + tokenStorageKey + `"}` + "\n",
+		},
+		{
+			scenario:       "could not list tokens",
+			mockStorage:    mock.NoMockStorage,
+			withoutListing: true,
+			expectedLog:    `error: could not list tokens {"error":{}}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			l := &ctxd.LoggerMock{}
+			options := []SchedulerOption{
+				WithSchedulerClock(test.NewClock()),
+				WithSchedulerLogger(l),
+				WithCheckInterval(time.Hour),
+			}
+
+			if !tc.withoutListing {
+				options = append(options, WithSchedulerKeys(tokenStorageKey))
+			}
+
+			sc := NewScheduler(NewStorage(WithKeyring(tc.mockStorage(t))),
+				RefresherFunc(func(context.Context, string, auth.OAuthToken) (auth.OAuthToken, error) {
+					t.Fatal("unexpected refresh")
+
+					return auth.OAuthToken{}, nil
+				}),
+				options...,
+			)
+
+			assert.Equal(t, now.Add(time.Hour), sc.tick(context.Background()))
+			assert.Equal(t, tc.expectedLog, l.String())
+		})
+	}
+}
+
+func TestScheduler_StartStop(t *testing.T) {
+	t.Parallel()
+
+	s := NewStorage(WithKeyring(n26keychain.NewMemoryStorage()))
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{
+		AccessToken:      "access",
+		ExpiresAt:        time.Now().Add(time.Second),
+		RefreshExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	sc := NewScheduler(s,
+		RefresherFunc(func(_ context.Context, _ string, token auth.OAuthToken) (auth.OAuthToken, error) {
+			token.AccessToken = "new-access"
+			token.ExpiresAt = time.Now().Add(time.Hour)
+
+			return token, nil
+		}),
+		WithSchedulerKeys(tokenStorageKey),
+		WithRefreshBefore(time.Minute),
+	)
+
+	sc.Start(context.Background())
+	sc.Start(context.Background())
+
+	assert.Eventually(t, func() bool {
+		token, err := s.Get(context.Background(), tokenStorageKey)
+
+		return err == nil && token.AccessToken == "new-access"
+	}, time.Second, 10*time.Millisecond)
+
+	sc.Stop()
+	sc.Stop()
+}
+
+func TestScheduler_StopOnContextDone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sc := NewScheduler(NewStorage(WithKeyring(n26keychain.NewMemoryStorage())), nil, WithSchedulerKeys())
+
+	sc.Start(ctx)
+	cancel()
+
+	// Stop returns once the scheduler is stopped.
+	sc.Stop()
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/nhatthm/n26api"
 	"github.com/nhatthm/n26api/pkg/auth"
 	"github.com/zalando/go-keyring"
+	"go.nhat.io/clock"
 
 	"github.com/nhatthm/n26keychain"
 )
@@ -26,17 +27,37 @@ type KeychainStorage interface {
 	Delete(ctx context.Context, key string) error
 }
 
+const swapAttempts = 3
+
 // StorageOption configures Storage.
 type StorageOption func(s *Storage)
 
 // Storage provides token from keychain.
 type Storage struct {
-	storage n26keychain.Storage
+	storage n26keychain.StorageContext
+	clock   clock.Clock
+
+	expiryCheck    bool
+	deleteExpired  bool
+	lifetimeHook   LifetimeHook
+	compareAndSwap bool
+
+	serviceNamespace string
+	keyNamespace     string
+
+	tracing        bool
+	tracingOptions []n26keychain.TracingOption
+
+	readOnly bool
+	index    bool
+
+	locker      Locker
+	lockOptions []LockedStorageOption
 }
 
 // Get gets token from keychain.
 func (s *Storage) Get(ctx context.Context, key string) (auth.OAuthToken, error) {
-	data, err := s.storage.Get(key)
+	data, err := s.storage.GetContext(ctx, key)
 	if err != nil {
 		if errors.Is(err, keyring.ErrNotFound) {
 			return auth.OAuthToken{}, nil
@@ -45,6 +66,38 @@ func (s *Storage) Get(ctx context.Context, key string) (auth.OAuthToken, error)
 		return auth.OAuthToken{}, err
 	}
 
+	token, err := decode(ctx, data)
+	if err != nil {
+		return auth.OAuthToken{}, err
+	}
+
+	return s.checkExpiry(ctx, key, token), nil
+}
+
+// Watch watches a token in keychain in background, until the context is done. When it changes, for example after a
+// login from another process, the callback is called with the new token, or with an empty token if it is deleted.
+func (s *Storage) Watch(
+	ctx context.Context,
+	key string,
+	callback func(token auth.OAuthToken, err error),
+	options ...n26keychain.WatchOption,
+) {
+	events := n26keychain.Watch(ctx, n26keychain.FromStorageContext(s.storage), key, options...)
+
+	go func() {
+		for e := range events {
+			if e.Deleted {
+				callback(auth.OAuthToken{}, nil)
+
+				continue
+			}
+
+			callback(decode(ctx, e.Value))
+		}
+	}()
+}
+
+func decode(ctx context.Context, data string) (auth.OAuthToken, error) {
 	var token auth.OAuthToken
 
 	if err := json.Unmarshal([]byte(data), &token); err != nil {
@@ -56,17 +109,59 @@ func (s *Storage) Get(ctx context.Context, key string) (auth.OAuthToken, error)
 
 // Set persists token to keychain.
 func (s *Storage) Set(ctx context.Context, key string, token auth.OAuthToken) error {
+	if s.readOnly {
+		return ctxd.WrapError(ctx, n26keychain.ErrReadOnly, "could not persist token")
+	}
+
 	data, err := json.Marshal(token)
 	if err != nil {
 		return ctxd.WrapError(ctx, err, "could not marshal token")
 	}
 
-	return s.storage.Set(key, string(data))
+	if s.compareAndSwap {
+		return s.swap(ctx, key, token, string(data))
+	}
+
+	return s.storage.SetContext(ctx, key, string(data))
+}
+
+// swap persists the token unless the stored one expires later. The check and the write are retried if the stored token
+// changes in between, until the context is done.
+func (s *Storage) swap(ctx context.Context, key string, token auth.OAuthToken, data string) error {
+	storage := n26keychain.FromStorageContext(s.storage)
+
+	var err error
+
+	for i := 0; i < swapAttempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var current, version string
+
+		current, version, err = n26keychain.GetVersion(storage, key)
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+
+		if err == nil {
+			stored, decodeErr := decode(ctx, current)
+			if decodeErr == nil && stored.ExpiresAt.After(token.ExpiresAt) {
+				return ctxd.WrapError(ctx, n26keychain.ErrConflict, "stored token is newer")
+			}
+		}
+
+		if _, err = n26keychain.SetIfMatch(storage, key, version, data); !errors.Is(err, n26keychain.ErrConflict) {
+			return err
+		}
+	}
+
+	return err
 }
 
 // Delete deletes the token in keychain.
-func (s *Storage) Delete(_ context.Context, key string) error {
-	err := s.storage.Delete(key)
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	err := s.storage.DeleteContext(ctx, key)
 	if err != nil && errors.Is(err, keyring.ErrNotFound) {
 		return nil
 	}
@@ -74,27 +169,169 @@ func (s *Storage) Delete(_ context.Context, key string) error {
 	return err
 }
 
+// Keys returns the keys of all the tokens in keychain, if the keychain storage supports listing its keys, see WithIndex.
+func (s *Storage) Keys() ([]string, error) {
+	return n26keychain.Keys(n26keychain.FromStorageContext(s.storage))
+}
+
+// History returns the previous versions of a token, if the keychain storage keeps them, see
+// n26keychain.NewHistoryStorage. The values are the tokens as they are stored in keychain.
+func (s *Storage) History(key string) ([]n26keychain.HistoryEntry, error) {
+	return n26keychain.History(n26keychain.FromStorageContext(s.storage), key)
+}
+
+// Rollback restores a previous version of a token in keychain.
+func (s *Storage) Rollback(key string, version int) error {
+	return n26keychain.Rollback(n26keychain.FromStorageContext(s.storage), key, version)
+}
+
 // NewStorage returns keychain as a token storage.
 func NewStorage(options ...StorageOption) *Storage {
 	s := &Storage{
-		storage: n26keychain.NewStorage(tokenStorageService),
+		clock: clock.New(),
 	}
 
 	for _, o := range options {
 		o(s)
 	}
 
+	if s.storage == nil {
+		s.storage = n26keychain.ToStorageContext(
+			n26keychain.NewStorage(n26keychain.NamespacedService(tokenStorageService, s.serviceNamespace)),
+		)
+	}
+
+	if s.index {
+		s.storage = n26keychain.ToStorageContext(n26keychain.NewIndexedStorage(n26keychain.FromStorageContext(s.storage)))
+	}
+
+	if s.tracing {
+		s.storage = n26keychain.ToStorageContext(n26keychain.NewTracingStorage(
+			n26keychain.FromStorageContext(s.storage),
+			n26keychain.NamespacedService(tokenStorageService, s.serviceNamespace),
+			s.tracingOptions...,
+		))
+	}
+
+	if s.readOnly {
+		s.storage = n26keychain.ToStorageContext(n26keychain.NewReadOnlyStorage(n26keychain.FromStorageContext(s.storage)))
+	}
+
+	if s.keyNamespace != "" {
+		s.storage = n26keychain.ToStorageContext(
+			n26keychain.NewNamespacedStorage(n26keychain.FromStorageContext(s.storage), s.keyNamespace),
+		)
+	}
+
 	return s
 }
 
 // WithKeyring sets keychain storage for Storage.
 func WithKeyring(storage n26keychain.Storage) StorageOption {
+	return func(s *Storage) {
+		s.storage = n26keychain.ToStorageContext(storage)
+	}
+}
+
+// WithKeyringContext sets a context-aware keychain storage for Storage.
+func WithKeyringContext(storage n26keychain.StorageContext) StorageOption {
 	return func(s *Storage) {
 		s.storage = storage
 	}
 }
 
+// WithServiceNamespace appends the namespace to the keychain service of Storage, for example "n26api.token.staging".
+// It has no effect when the keychain storage is set with WithKeyring or WithKeyringContext.
+func WithServiceNamespace(namespace string) StorageOption {
+	return func(s *Storage) {
+		s.serviceNamespace = namespace
+	}
+}
+
+// WithKeyNamespace prefixes the keys of the tokens with the namespace, see n26keychain.NewNamespacedStorage.
+func WithKeyNamespace(namespace string) StorageOption {
+	return func(s *Storage) {
+		s.keyNamespace = namespace
+	}
+}
+
+// WithCompareAndSwap makes Storage keep the stored token when it expires later than the one to persist, so a stale
+// refresh never overwrites a newer token, and ErrConflict of n26keychain is returned instead. The keychain storage must
+// support versions, see n26keychain.NewVersionedStorage. The attempts stop when the context is done, but an attempt that
+// started is not interrupted, because the conditional writes are not aware of the context.
+func WithCompareAndSwap() StorageOption {
+	return func(s *Storage) {
+		s.compareAndSwap = true
+	}
+}
+
+// WithTracing records the operations of the keychain storage of Storage in OpenTelemetry spans, see
+// n26keychain.NewTracingStorage. With WithTokenStorage, the operations of the n26 client on the tokens are recorded
+// instead, see NewTracingStorage, so the spans also cover the lock of WithLocker and the tokens that can not be
+// unmarshaled.
+func WithTracing(options ...n26keychain.TracingOption) StorageOption {
+	return func(s *Storage) {
+		s.tracing = true
+		s.tracingOptions = options
+	}
+}
+
+// WithReadOnly makes Storage never change the tokens in keychain, for example for reporting jobs. Set, Delete and
+// Rollback return ErrReadOnly of n26keychain, and an expired token is not deleted even with WithDeleteExpired.
+func WithReadOnly() StorageOption {
+	return func(s *Storage) {
+		s.readOnly = true
+	}
+}
+
+// WithIndex keeps the list of the tokens in keychain, see n26keychain.NewIndexedStorage, so they can be listed with
+// Storage.Keys even when the keychain storage can not enumerate its entries, like the system keyring. The tokens that
+// were set before the index was used are not listed.
+func WithIndex() StorageOption {
+	return func(s *Storage) {
+		s.index = true
+	}
+}
+
+// WithLocker makes the n26 client refresh a token in only one process at a time, see NewLockedStorage. It is applied by
+// WithTokenStorage, use NewLockedStorage to wrap a Storage that is created by NewStorage.
+func WithLocker(locker Locker, options ...LockedStorageOption) StorageOption {
+	return func(s *Storage) {
+		s.locker = locker
+		s.lockOptions = options
+	}
+}
+
 // WithTokenStorage sets keychain as a token storage for n26 client.
 func WithTokenStorage(options ...StorageOption) n26api.Option {
-	return n26api.WithTokenStorage(NewStorage(options...))
+	return n26api.WithTokenStorage(newTokenStorage(options...))
+}
+
+// newTokenStorage creates the token storage of the n26 client, with the decorators of the options.
+func newTokenStorage(options ...StorageOption) KeychainStorage {
+	var tracing bool
+
+	// The operations on the tokens are traced instead of the ones of the keychain storage.
+	options = append(options[:len(options):len(options)], func(s *Storage) {
+		tracing, s.tracing = s.tracing, false
+	})
+
+	s := NewStorage(options...)
+
+	var storage KeychainStorage = s
+
+	if s.locker != nil {
+		storage = NewLockedStorage(storage, s.locker,
+			append([]LockedStorageOption{WithLockClock(s.clock)}, s.lockOptions...)...,
+		)
+	}
+
+	if tracing {
+		storage = NewTracingStorage(storage,
+			n26keychain.NamespacedService(tokenStorageService, s.serviceNamespace),
+			s.tracingOptions...,
+		)
+	}
+
+	return storage
 }
@@ -201,3 +201,401 @@ func TestTokenStorage_DeleteKeyring(t *testing.T) {
 		assert.Equal(t, keyring.ErrNotFound, err)
 	})
 }
+
+func TestTokenStorage_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := NewStorage(WithKeyring(mock.NoMockStorage(t)))
+
+	token, err := p.Get(ctx, tokenStorageKey)
+
+	assert.Empty(t, token)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = p.Set(ctx, tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = p.Delete(ctx, tokenStorageKey)
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTokenStorage_WithKeyringContext(t *testing.T) {
+	expectedToken := auth.OAuthToken{
+		AccessToken:      "access",
+		RefreshToken:     "refresh",
+		ExpiresAt:        time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		RefreshExpiresAt: time.Date(2020, 1, 2, 4, 4, 5, 0, time.UTC),
+	}
+
+	p := NewStorage(WithKeyringContext(n26keychain.ToStorageContext(n26keychain.NewMemoryStorage())))
+
+	err := p.Set(context.Background(), tokenStorageKey, expectedToken)
+	require.NoError(t, err)
+
+	token, err := p.Get(context.Background(), tokenStorageKey)
+
+	assert.Equal(t, expectedToken, token)
+	assert.NoError(t, err)
+}
+
+func TestTokenStorage_Keys(t *testing.T) {
+	s := NewStorage(WithKeyring(n26keychain.NewIndexedStorage(n26keychain.NewMemoryStorage())))
+
+	keys, err := s.Keys()
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+
+	err = s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	keys, err = s.Keys()
+
+	assert.Equal(t, []string{tokenStorageKey}, keys)
+	assert.NoError(t, err)
+
+	err = s.Delete(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	keys, err = s.Keys()
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+}
+
+func TestTokenStorage_KeysWithIndex(t *testing.T) {
+	// The storage can not list its keys.
+	memory := n26keychain.NewMemoryStorage()
+	s := NewStorage(WithKeyring(struct{ n26keychain.Storage }{memory}), WithIndex())
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	keys, err := s.Keys()
+
+	assert.Equal(t, []string{tokenStorageKey}, keys)
+	assert.NoError(t, err)
+
+	_, err = memory.Get(n26keychain.IndexKey)
+
+	assert.NoError(t, err)
+}
+
+func TestTokenStorage_KeysNotSupported(t *testing.T) {
+	s := NewStorage(WithKeyring(mock.NoMockStorage(t)))
+
+	keys, err := s.Keys()
+
+	assert.Nil(t, keys)
+	assert.ErrorIs(t, err, n26keychain.ErrListNotSupported)
+}
+
+func TestTokenStorage_WithKeyNamespace(t *testing.T) {
+	s := n26keychain.NewMemoryStorage()
+
+	staging := NewStorage(WithKeyring(s), WithKeyNamespace("staging"))
+	production := NewStorage(WithKeyNamespace("production"), WithKeyring(s))
+
+	err := staging.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	token, err := staging.Get(context.Background(), tokenStorageKey)
+
+	assert.Equal(t, auth.OAuthToken{AccessToken: "access"}, token)
+	assert.NoError(t, err)
+
+	token, err = production.Get(context.Background(), tokenStorageKey)
+
+	assert.Empty(t, token)
+	assert.NoError(t, err)
+
+	keys, err := staging.Keys()
+
+	assert.Equal(t, []string{tokenStorageKey}, keys)
+	assert.NoError(t, err)
+
+	keys, err = production.Keys()
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+}
+
+func TestTokenStorage_WithServiceNamespaceKeyring(t *testing.T) {
+	service := n26keychain.NamespacedService(tokenStorageService, "staging")
+
+	expect := func(t *testing.T, s n26keychain.Storage) { //nolint: thelper
+		err := s.Set(tokenStorageKey, `{"access_token":"access"}`)
+		require.NoError(t, err)
+	}
+
+	test.Run(t, service, tokenStorageKey, expect, func(t *testing.T) { //nolint: thelper
+		token, err := NewStorage(WithServiceNamespace("staging")).Get(context.Background(), tokenStorageKey)
+
+		assert.Equal(t, auth.OAuthToken{AccessToken: "access"}, token)
+		assert.NoError(t, err)
+
+		token, err = NewStorage().Get(context.Background(), tokenStorageKey)
+
+		assert.Empty(t, token)
+		assert.NoError(t, err)
+	})
+}
+
+func TestTokenStorage_Watch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := NewStorage(WithKeyring(memory))
+
+	type change struct {
+		token auth.OAuthToken
+		err   error
+	}
+
+	changes := make(chan change, 1)
+
+	s.Watch(ctx, tokenStorageKey, func(token auth.OAuthToken, err error) {
+		changes <- change{token: token, err: err}
+	}, n26keychain.WithPollInterval(time.Hour))
+
+	receive := func() change {
+		select {
+		case ch := <-changes:
+			return ch
+
+		case <-time.After(time.Second):
+			t.Fatal("no change")
+		}
+
+		return change{}
+	}
+
+	// Another process logs in.
+	err := NewStorage(WithKeyring(memory)).Set(ctx, tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	assert.Equal(t, change{token: auth.OAuthToken{AccessToken: "access"}}, receive())
+
+	err = memory.Set(tokenStorageKey, "{")
+	require.NoError(t, err)
+
+	assert.EqualError(t, receive().err, "could not unmarshal token: unexpected end of JSON input")
+
+	err = memory.Delete(tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Equal(t, change{}, receive())
+}
+
+func TestTokenStorage_CompareAndSwap(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	memory := n26keychain.NewMemoryStorage()
+	s := NewStorage(WithKeyring(n26keychain.NewVersionedStorage(memory)), WithKeyNamespace("staging"), WithCompareAndSwap())
+
+	older := auth.OAuthToken{AccessToken: "older", ExpiresAt: now}
+	newer := auth.OAuthToken{AccessToken: "newer", ExpiresAt: now.Add(time.Minute)}
+
+	err := s.Set(context.Background(), tokenStorageKey, older)
+	require.NoError(t, err)
+
+	err = s.Set(context.Background(), tokenStorageKey, newer)
+	require.NoError(t, err)
+
+	// A stale refresh does not overwrite the newer token.
+	err = s.Set(context.Background(), tokenStorageKey, older)
+
+	assert.ErrorIs(t, err, n26keychain.ErrConflict)
+	assert.EqualError(t, err, "stored token is newer: entry was changed concurrently")
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+
+	assert.Equal(t, newer, token)
+	assert.NoError(t, err)
+
+	// The same token.
+	err = s.Set(context.Background(), tokenStorageKey, newer)
+	require.NoError(t, err)
+
+	// Invalid stored token.
+	err = memory.Set("staging:"+tokenStorageKey, "{")
+	require.NoError(t, err)
+
+	err = s.Set(context.Background(), tokenStorageKey, older)
+	require.NoError(t, err)
+}
+
+func TestTokenStorage_CompareAndSwapWrapped(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	memory := n26keychain.NewMemoryStorage()
+	s := NewStorage(
+		WithKeyring(n26keychain.NewCacheStorage(n26keychain.NewVersionedStorage(memory), time.Minute)),
+		WithCompareAndSwap(),
+	)
+
+	older := auth.OAuthToken{AccessToken: "older", ExpiresAt: now}
+	newer := auth.OAuthToken{AccessToken: "newer", ExpiresAt: now.Add(time.Minute)}
+
+	require.NoError(t, s.Set(context.Background(), tokenStorageKey, newer))
+
+	err := s.Set(context.Background(), tokenStorageKey, older)
+
+	assert.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+
+	assert.Equal(t, newer, token)
+	assert.NoError(t, err)
+}
+
+func TestTokenStorage_CompareAndSwapError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		storage       func(t *testing.T) n26keychain.Storage
+		expectedError error
+	}{
+		{
+			scenario: "not supported",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				return mock.NoMockStorage(t)
+			},
+			expectedError: n26keychain.ErrVersionNotSupported,
+		},
+		{
+			scenario: "could not get",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				return n26keychain.NewVersionedStorage(mock.MockStorage(func(s *mock.Storage) {
+					s.On("Get", tokenStorageKey).Return("", keyring.ErrUnsupportedPlatform)
+				})(t))
+			},
+			expectedError: keyring.ErrUnsupportedPlatform,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewStorage(WithKeyring(tc.storage(t)), WithCompareAndSwap())
+
+			err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+
+			assert.ErrorIs(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestTokenStorage_CompareAndSwapCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	// The storage is not called.
+	s := NewStorage(WithKeyring(n26keychain.NewVersionedStorage(mock.NoMockStorage(t))), WithCompareAndSwap())
+
+	err := s.Set(ctx, tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTokenStorage_CompareAndSwapCanceledBetweenAttempts(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage := &conflictStorage{Storage: n26keychain.NewMemoryStorage(), onConflict: cancel}
+	s := NewStorage(WithKeyring(storage), WithCompareAndSwap())
+
+	err := s.Set(ctx, tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, storage.attempts)
+}
+
+// conflictStorage always fails the conditional writes with a conflict.
+type conflictStorage struct {
+	n26keychain.Storage
+
+	onConflict func()
+	attempts   int
+}
+
+func (s *conflictStorage) GetVersion(string) (string, string, error) {
+	return "", "", keyring.ErrNotFound
+}
+
+func (s *conflictStorage) SetIfMatch(string, string, string) (string, error) {
+	s.attempts++
+
+	s.onConflict()
+
+	return "", n26keychain.ErrConflict
+}
+
+func TestTokenStorage_Rollback(t *testing.T) {
+	t.Parallel()
+
+	s := NewStorage(WithKeyring(n26keychain.NewHistoryStorage(n26keychain.NewMemoryStorage(), 0)), WithKeyNamespace("staging"))
+
+	first := auth.OAuthToken{AccessToken: "first"}
+	second := auth.OAuthToken{AccessToken: "second"}
+
+	require.NoError(t, s.Set(context.Background(), tokenStorageKey, first))
+	require.NoError(t, s.Set(context.Background(), tokenStorageKey, second))
+
+	history, err := s.History(tokenStorageKey)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	require.NoError(t, s.Rollback(tokenStorageKey, history[0].Version))
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+
+	assert.Equal(t, first, token)
+	assert.NoError(t, err)
+
+	_, err = NewStorage(WithKeyring(n26keychain.NewMemoryStorage())).History(tokenStorageKey)
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+}
+
+func TestTokenStorage_WithReadOnly(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := NewStorage(WithKeyring(memory), WithReadOnly(), WithDeleteExpired())
+
+	require.NoError(t, memory.Set(tokenStorageKey, `{"access_token":"foo"}`))
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "bar"})
+
+	assert.ErrorIs(t, err, n26keychain.ErrReadOnly)
+	assert.EqualError(t, err, "could not persist token: storage is read-only")
+
+	assert.ErrorIs(t, s.Delete(context.Background(), tokenStorageKey), n26keychain.ErrReadOnly)
+	assert.ErrorIs(t, s.Rollback(tokenStorageKey, 1), n26keychain.ErrReadOnly)
+
+	token, err := s.Get(context.Background(), tokenStorageKey)
+
+	assert.Equal(t, auth.OAuthToken{AccessToken: "foo"}, token)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,69 @@
+package token
+
+import (
+	"context"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+
+	"github.com/nhatthm/n26keychain"
+)
+
+var (
+	_ KeychainStorage    = (*tracingStorage)(nil)
+	_ n26keychain.Lister = (*tracingStorage)(nil)
+)
+
+type tracingStorage struct {
+	storage KeychainStorage
+	tracer  *n26keychain.Tracer
+}
+
+// Get gets token from the underlying storage in a span.
+func (s *tracingStorage) Get(ctx context.Context, key string) (auth.OAuthToken, error) {
+	ctx, end := s.tracer.Start(ctx, n26keychain.MetricsOperationGet, key)
+	token, err := s.storage.Get(ctx, key)
+
+	end(err)
+
+	return token, err
+}
+
+// Set persists token to the underlying storage in a span.
+func (s *tracingStorage) Set(ctx context.Context, key string, token auth.OAuthToken) error {
+	ctx, end := s.tracer.Start(ctx, n26keychain.MetricsOperationSet, key)
+	err := s.storage.Set(ctx, key, token)
+
+	end(err)
+
+	return err
+}
+
+// Delete deletes the token in the underlying storage in a span.
+func (s *tracingStorage) Delete(ctx context.Context, key string) error {
+	ctx, end := s.tracer.Start(ctx, n26keychain.MetricsOperationDelete, key)
+	err := s.storage.Delete(ctx, key)
+
+	end(err)
+
+	return err
+}
+
+// Keys returns the keys of all the tokens, if the underlying storage supports listing its keys.
+func (s *tracingStorage) Keys() ([]string, error) {
+	l, ok := s.storage.(n26keychain.Lister)
+	if !ok {
+		return nil, n26keychain.ErrListNotSupported
+	}
+
+	return l.Keys()
+}
+
+// NewTracingStorage creates a token storage that records every operation of the underlying storage in an OpenTelemetry
+// span, see n26keychain.NewTracingStorage. Unlike the keychain storage, it also sees the errors of the tokens that can
+// not be unmarshaled.
+func NewTracingStorage(storage KeychainStorage, service string, options ...n26keychain.TracingOption) KeychainStorage {
+	return &tracingStorage{
+		storage: storage,
+		tracer:  n26keychain.NewTracer(service, options...),
+	}
+}
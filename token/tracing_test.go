@@ -0,0 +1,107 @@
+//go:build !integration
+
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nhatthm/n26api/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestTracingStorage(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	memory := n26keychain.NewMemoryStorage()
+	s := NewTracingStorage(NewStorage(WithKeyring(memory)), "n26api.token", n26keychain.WithTracerProvider(tp))
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	err = memory.Set(tokenStorageKey, "{")
+	require.NoError(t, err)
+
+	_, err = s.Get(context.Background(), tokenStorageKey)
+	require.Error(t, err)
+
+	err = s.Delete(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	keys, err := s.(n26keychain.Lister).Keys()
+
+	assert.Empty(t, keys)
+	assert.NoError(t, err)
+
+	spans := tp.Spans()
+	require.Len(t, spans, 3)
+
+	assert.Equal(t, "keychain.set", spans[0].Name)
+	assert.Equal(t, "keychain.get", spans[1].Name)
+	assert.Equal(t, "unmarshal", spans[1].Attributes[n26keychain.AttributeErrorClass])
+	assert.Equal(t, codes.Error, spans[1].Status)
+	assert.Equal(t, "keychain.delete", spans[2].Name)
+	assert.Equal(t, n26keychain.HashKey(tokenStorageKey), spans[2].Attributes[n26keychain.AttributeKeyHash])
+}
+
+func TestTokenStorage_WithTracing(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	memory := n26keychain.NewVersionedStorage(n26keychain.NewMemoryStorage())
+	s := NewStorage(
+		WithKeyring(memory),
+		WithKeyNamespace("staging"),
+		WithCompareAndSwap(),
+		WithTracing(n26keychain.WithTracerProvider(tp)),
+	)
+
+	err := s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	_, err = s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	spans := tp.Spans()
+	require.Len(t, spans, 1)
+
+	assert.Equal(t, "keychain.get", spans[0].Name)
+	assert.Equal(t, "n26api.token", spans[0].Attributes[n26keychain.AttributeService])
+	assert.Equal(t, n26keychain.HashKey("staging:"+tokenStorageKey), spans[0].Attributes[n26keychain.AttributeKeyHash])
+}
+
+func TestWithTokenStorage_Tracing(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	s := newTokenStorage(
+		WithKeyring(n26keychain.NewMemoryStorage()),
+		WithServiceNamespace("staging"),
+		WithLocker(NewFileLocker(t.TempDir())),
+		WithTracing(n26keychain.WithTracerProvider(tp)),
+	)
+
+	// The token is missing, the lock is held until the token is persisted.
+	token, err := s.Get(context.Background(), tokenStorageKey)
+	require.NoError(t, err)
+
+	assert.Empty(t, token)
+
+	err = s.Set(context.Background(), tokenStorageKey, auth.OAuthToken{AccessToken: "access"})
+	require.NoError(t, err)
+
+	// The operations on the tokens are traced, instead of the ones of the keychain storage.
+	spans := tp.Spans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "keychain.get", spans[0].Name)
+	assert.Equal(t, "keychain.set", spans[1].Name)
+	assert.Equal(t, "n26api.token.staging", spans[1].Attributes[n26keychain.AttributeService])
+	assert.Equal(t, n26keychain.HashKey(tokenStorageKey), spans[1].Attributes[n26keychain.AttributeKeyHash])
+}
@@ -0,0 +1,199 @@
+package n26keychain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/zalando/go-keyring"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/nhatthm/n26keychain"
+
+// Attributes of the spans.
+const (
+	AttributeOperation  = attribute.Key("keychain.operation")
+	AttributeService    = attribute.Key("keychain.service")
+	AttributeKeyHash    = attribute.Key("keychain.key_hash")
+	AttributeErrorClass = attribute.Key("keychain.error_class")
+)
+
+var (
+	_ Storage        = (*tracingStorage)(nil)
+	_ StorageContext = (*tracingStorage)(nil)
+	_ Lister         = (*tracingStorage)(nil)
+	_ Notifier       = (*tracingStorage)(nil)
+	_ Versioned      = (*tracingStorage)(nil)
+	_ HistoryKeeper  = (*tracingStorage)(nil)
+)
+
+// TracingOption configures Tracer.
+type TracingOption func(t *Tracer)
+
+// Tracer creates the spans of the operations of a storage.
+type Tracer struct {
+	provider trace.TracerProvider
+	tracer   trace.Tracer
+	service  string
+}
+
+// Start starts a span for an operation on a key, from the context. The key is hashed, so it does not leak the account
+// or the device in the traces. The returned function ends the span with the error of the operation. A missing entry is
+// not an error of the span.
+func (t *Tracer) Start(ctx context.Context, operation, key string) (context.Context, func(err error)) {
+	attrs := []attribute.KeyValue{
+		AttributeOperation.String(operation),
+		AttributeService.String(t.service),
+	}
+
+	if key != "" {
+		attrs = append(attrs, AttributeKeyHash.String(HashKey(key)))
+	}
+
+	ctx, span := t.tracer.Start(ctx, "keychain."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+
+	return ctx, func(err error) {
+		defer span.End()
+
+		span.SetAttributes(AttributeErrorClass.String(ErrorClass(err)))
+
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+}
+
+// NewTracer creates a tracer for the storage of the service. The global tracer provider of OpenTelemetry is used,
+// unless WithTracerProvider is used.
+func NewTracer(service string, options ...TracingOption) *Tracer {
+	t := &Tracer{
+		service: service,
+	}
+
+	for _, o := range options {
+		o(t)
+	}
+
+	if t.provider == nil {
+		t.provider = otel.GetTracerProvider()
+	}
+
+	t.tracer = t.provider.Tracer(tracerName)
+
+	return t
+}
+
+// WithTracerProvider sets the tracer provider of the spans.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(t *Tracer) {
+		t.provider = provider
+	}
+}
+
+// HashKey returns the hash of a key, the first 8 bytes of its SHA-256 in hex, to identify it in the traces without
+// revealing it.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+type tracingStorage struct {
+	storage StorageContext
+	tracer  *Tracer
+}
+
+// Set sets password in the underlying storage in a span.
+func (s *tracingStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password in the underlying storage in a span.
+func (s *tracingStorage) SetContext(ctx context.Context, user, password string) error {
+	ctx, end := s.tracer.Start(ctx, MetricsOperationSet, user)
+	err := s.storage.SetContext(ctx, user, password)
+
+	end(err)
+
+	return err
+}
+
+// Get gets password from the underlying storage in a span.
+func (s *tracingStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password from the underlying storage in a span.
+func (s *tracingStorage) GetContext(ctx context.Context, user string) (string, error) {
+	ctx, end := s.tracer.Start(ctx, MetricsOperationGet, user)
+	password, err := s.storage.GetContext(ctx, user)
+
+	end(err)
+
+	return password, err
+}
+
+// Delete deletes secret from the underlying storage in a span.
+func (s *tracingStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage in a span.
+func (s *tracingStorage) DeleteContext(ctx context.Context, user string) error {
+	ctx, end := s.tracer.Start(ctx, MetricsOperationDelete, user)
+	err := s.storage.DeleteContext(ctx, user)
+
+	end(err)
+
+	return err
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *tracingStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *tracingStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+// GetVersion gets password and its version, if the underlying storage supports versions.
+func (s *tracingStorage) GetVersion(user string) (string, string, error) {
+	return GetVersion(FromStorageContext(s.storage), user)
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the underlying storage supports
+// versions.
+func (s *tracingStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	return SetIfMatch(FromStorageContext(s.storage), user, expectedVersion, password)
+}
+
+// History returns the versions of the key, if the underlying storage keeps them.
+func (s *tracingStorage) History(user string) ([]HistoryEntry, error) {
+	return History(FromStorageContext(s.storage), user)
+}
+
+// Rollback sets the value of a version as the current value, if the underlying storage keeps the history.
+func (s *tracingStorage) Rollback(user string, version int) error {
+	return Rollback(FromStorageContext(s.storage), user, version)
+}
+
+// NewTracingStorage creates a storage that records every operation of the underlying storage in an OpenTelemetry span,
+// with the operation, the service, the hash of the key and the error class. The spans are children of the span in the
+// context of the operation.
+func NewTracingStorage(storage Storage, service string, options ...TracingOption) Storage {
+	return &tracingStorage{
+		storage: ToStorageContext(storage),
+		tracer:  NewTracer(service, options...),
+	}
+}
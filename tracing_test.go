@@ -0,0 +1,96 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+	"github.com/nhatthm/n26keychain/test"
+)
+
+func TestTracingStorage(t *testing.T) {
+	t.Parallel()
+
+	tp := test.NewTracerProvider()
+	s := n26keychain.ToStorageContext(n26keychain.NewTracingStorage(mock.MockStorage(func(s *mock.Storage) {
+		s.On("Set", "foo", "bar").Return(nil)
+		s.On("Get", "foo").Return("", keyring.ErrNotFound)
+		s.On("Delete", "foo").Return(errors.New("delete error"))
+	})(t), "n26api.credentials", n26keychain.WithTracerProvider(tp)))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+	require.NoError(t, s.SetContext(ctx, "foo", "bar"))
+
+	_, err := s.GetContext(ctx, "foo")
+	require.ErrorIs(t, err, keyring.ErrNotFound)
+
+	err = s.DeleteContext(ctx, "foo")
+	require.EqualError(t, err, "delete error")
+
+	spans := tp.Spans()
+	require.Len(t, spans, 3)
+
+	expected := []struct {
+		name       string
+		errorClass string
+		status     codes.Code
+	}{
+		{name: "keychain.set", errorClass: "none", status: codes.Unset},
+		{name: "keychain.get", errorClass: "not_found", status: codes.Unset},
+		{name: "keychain.delete", errorClass: "other", status: codes.Error},
+	}
+
+	for i, e := range expected {
+		span := spans[i]
+
+		assert.Equal(t, e.name, span.Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent)
+		assert.Equal(t, "n26api.credentials", span.Attributes[n26keychain.AttributeService])
+		assert.Equal(t, n26keychain.HashKey("foo"), span.Attributes[n26keychain.AttributeKeyHash])
+		assert.Equal(t, e.errorClass, span.Attributes[n26keychain.AttributeErrorClass])
+		assert.Equal(t, e.status, span.Status)
+	}
+
+	assert.Equal(t, "set", spans[0].Attributes[n26keychain.AttributeOperation])
+	assert.Len(t, spans[2].Errors, 1)
+}
+
+func TestTracingStorage_Forward(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewTracingStorage(n26keychain.NewVersionedStorage(memory), "service")
+
+	version, err := n26keychain.SetIfMatch(s, "foo", "", "bar")
+	require.NoError(t, err)
+
+	data, actual, err := n26keychain.GetVersion(s, "foo")
+
+	assert.Equal(t, "bar", data)
+	assert.Equal(t, version, actual)
+	assert.NoError(t, err)
+
+	keys, err := n26keychain.Keys(s)
+
+	assert.Equal(t, []string{"foo"}, keys)
+	assert.NoError(t, err)
+
+	_, err = n26keychain.History(s, "foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrHistoryNotSupported)
+}
+
+func TestHashKey(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "2c26b46b68ffc68f", n26keychain.HashKey("foo"))
+	assert.NotEqual(t, n26keychain.HashKey("foo"), n26keychain.HashKey("bar"))
+}
@@ -0,0 +1,208 @@
+package n26keychain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	versionPrefix = "n26keychain:ver:v1:"
+	versionSize   = 16
+)
+
+var (
+	// ErrConflict indicates that the entry was changed since its version was read.
+	ErrConflict = errors.New("entry was changed concurrently")
+	// ErrVersionNotSupported indicates that the storage does not support conditional writes.
+	ErrVersionNotSupported = errors.New("storage does not support versions")
+)
+
+var (
+	_ Storage        = (*versionedStorage)(nil)
+	_ StorageContext = (*versionedStorage)(nil)
+	_ Versioned      = (*versionedStorage)(nil)
+	_ Lister         = (*versionedStorage)(nil)
+	_ Notifier       = (*versionedStorage)(nil)
+)
+
+// Versioned is a storage that keeps a version alongside each value, for conditional writes.
+type Versioned interface {
+	// GetVersion gets password and its version.
+	GetVersion(user string) (string, string, error)
+	// SetIfMatch sets password only if the current version is the expected one, or if there is no entry when the
+	// expected version is empty. Otherwise, ErrConflict is returned. It returns the new version.
+	SetIfMatch(user, expectedVersion, password string) (string, error)
+}
+
+type versionedStorage struct {
+	storage StorageContext
+
+	mu sync.Mutex
+}
+
+// Set sets password with a new version.
+func (s *versionedStorage) Set(user, password string) error {
+	return s.SetContext(context.Background(), user, password)
+}
+
+// SetContext sets password with a new version.
+func (s *versionedStorage) SetContext(ctx context.Context, user, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.set(ctx, user, password)
+
+	return err
+}
+
+// Get gets password without its version.
+func (s *versionedStorage) Get(user string) (string, error) {
+	return s.GetContext(context.Background(), user)
+}
+
+// GetContext gets password without its version.
+func (s *versionedStorage) GetContext(ctx context.Context, user string) (string, error) {
+	password, _, err := s.get(ctx, user)
+
+	return password, err
+}
+
+// Delete deletes secret from the underlying storage.
+func (s *versionedStorage) Delete(user string) error {
+	return s.DeleteContext(context.Background(), user)
+}
+
+// DeleteContext deletes secret from the underlying storage.
+func (s *versionedStorage) DeleteContext(ctx context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.storage.DeleteContext(ctx, user)
+}
+
+// GetVersion gets password and its version.
+func (s *versionedStorage) GetVersion(user string) (string, string, error) {
+	return s.get(context.Background(), user)
+}
+
+// SetIfMatch sets password only if the current version is the expected one, or if there is no entry when the expected
+// version is empty.
+func (s *versionedStorage) SetIfMatch(user, expectedVersion, password string) (string, error) {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, version, err := s.get(ctx, user)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return "", err
+	}
+
+	if version != expectedVersion {
+		return "", fmt.Errorf("%w: %q", ErrConflict, user)
+	}
+
+	return s.set(ctx, user, password)
+}
+
+// Keys returns all the keys in the underlying storage, if it supports listing.
+func (s *versionedStorage) Keys() ([]string, error) {
+	return listKeys(s.storage)
+}
+
+// Notify notifies about the changes of the underlying storage, if it supports notifications.
+func (s *versionedStorage) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return notifyChanges(ctx, s.storage)
+}
+
+func (s *versionedStorage) get(ctx context.Context, user string) (string, string, error) {
+	data, err := s.storage.GetContext(ctx, user)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !strings.HasPrefix(data, versionPrefix) {
+		// The values that were written without a version are identified by their content.
+		sum := sha256.Sum256([]byte(data))
+
+		return data, "sha256:" + hex.EncodeToString(sum[:]), nil
+	}
+
+	version, password, ok := strings.Cut(strings.TrimPrefix(data, versionPrefix), ":")
+	if !ok {
+		return "", "", fmt.Errorf("invalid versioned value of %q", user)
+	}
+
+	return password, version, nil
+}
+
+func (s *versionedStorage) set(ctx context.Context, user, password string) (string, error) {
+	raw := make([]byte, versionSize)
+
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return "", fmt.Errorf("could not generate version: %w", err)
+	}
+
+	version := hex.EncodeToString(raw)
+
+	if err := s.storage.SetContext(ctx, user, versionPrefix+version+":"+password); err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// NewVersionedStorage creates a storage that keeps a random version alongside each value, so the writers can detect
+// concurrent changes with SetIfMatch. The conditional writes are atomic within the process, across processes they
+// only narrow the window of a lost update.
+func NewVersionedStorage(storage Storage) Storage {
+	return &versionedStorage{
+		storage: ToStorageContext(storage),
+	}
+}
+
+// GetVersion gets password and its version, if the storage supports versions. Otherwise, ErrVersionNotSupported is
+// returned.
+func GetVersion(s Storage, user string) (string, string, error) {
+	v, ok := versionedOf(s)
+	if !ok {
+		return "", "", ErrVersionNotSupported
+	}
+
+	return v.GetVersion(user)
+}
+
+// SetIfMatch sets password only if the current version is the expected one, if the storage supports versions.
+// Otherwise, ErrVersionNotSupported is returned.
+func SetIfMatch(s Storage, user, expectedVersion, password string) (string, error) {
+	v, ok := versionedOf(s)
+	if !ok {
+		return "", ErrVersionNotSupported
+	}
+
+	return v.SetIfMatch(user, expectedVersion, password)
+}
+
+func versionedOf(s interface{}) (Versioned, bool) {
+	switch s := s.(type) {
+	case *storageContext:
+		return versionedOf(s.storage)
+
+	case *storageNoContext:
+		return versionedOf(s.storage)
+
+	case Versioned:
+		return s, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,208 @@
+package n26keychain_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+func TestVersionedStorage(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewVersionedStorage(memory)
+
+	// Create.
+	_, err := n26keychain.SetIfMatch(s, "foo", "unknown", "1")
+
+	assert.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	v1, err := n26keychain.SetIfMatch(s, "foo", "", "1")
+	require.NoError(t, err)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", "", "1")
+
+	assert.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	data, version, err := n26keychain.GetVersion(s, "foo")
+
+	assert.Equal(t, "1", data)
+	assert.Equal(t, v1, version)
+	assert.NoError(t, err)
+
+	data, err = s.Get("foo")
+
+	assert.Equal(t, "1", data)
+	assert.NoError(t, err)
+
+	raw, err := memory.Get("foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "n26keychain:ver:v1:"+v1+":1", raw)
+
+	// Update.
+	v2, err := n26keychain.SetIfMatch(s, "foo", v1, "2")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, v1, v2)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", v1, "3")
+
+	assert.EqualError(t, err, `entry was changed concurrently: "foo"`)
+
+	// The same value has a new version.
+	require.NoError(t, s.Set("foo", "2"))
+
+	_, version, err = n26keychain.GetVersion(s, "foo")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, v2, version)
+
+	// Delete.
+	require.NoError(t, s.Delete("foo"))
+
+	_, _, err = n26keychain.GetVersion(s, "foo")
+
+	assert.Equal(t, keyring.ErrNotFound, err)
+}
+
+func TestVersionedStorage_Unversioned(t *testing.T) {
+	t.Parallel()
+
+	memory := n26keychain.NewMemoryStorage()
+	s := n26keychain.NewVersionedStorage(memory)
+
+	require.NoError(t, memory.Set("foo", "bar"))
+
+	data, version, err := n26keychain.GetVersion(s, "foo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar", data)
+	assert.True(t, strings.HasPrefix(version, "sha256:"))
+
+	_, err = n26keychain.SetIfMatch(s, "foo", "", "baz")
+
+	assert.ErrorIs(t, err, n26keychain.ErrConflict)
+
+	_, err = n26keychain.SetIfMatch(s, "foo", version, "baz")
+
+	assert.NoError(t, err)
+}
+
+func TestVersionedStorage_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewNamespacedStorage(n26keychain.NewVersionedStorage(n26keychain.NewMemoryStorage()), "staging")
+
+	_, version, err := n26keychain.GetVersion(s, "foo")
+	require.ErrorIs(t, err, keyring.ErrNotFound)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		written int
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := n26keychain.SetIfMatch(s, "foo", version, "bar")
+			if err == nil {
+				mu.Lock()
+				written++
+				mu.Unlock()
+
+				return
+			}
+
+			assert.ErrorIs(t, err, n26keychain.ErrConflict)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 1, written)
+}
+
+func TestVersionedStorage_Error(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		mockStorage   mock.StorageMocker
+		call          func(s n26keychain.Storage) error
+		expectedError string
+	}{
+		{
+			scenario: "could not get",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "foo").Return("", errors.New("get error"))
+			}),
+			call: func(s n26keychain.Storage) error {
+				_, err := n26keychain.SetIfMatch(s, "foo", "", "bar")
+
+				return err
+			},
+			expectedError: "get error",
+		},
+		{
+			scenario: "invalid value",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Get", "foo").Return("n26keychain:ver:v1:foobar", nil)
+			}),
+			call: func(s n26keychain.Storage) error {
+				_, err := s.Get("foo")
+
+				return err
+			},
+			expectedError: `invalid versioned value of "foo"`,
+		},
+		{
+			scenario: "could not set",
+			mockStorage: mock.MockStorage(func(s *mock.Storage) {
+				s.On("Set", "foo", testifyMock.Anything).Return(errors.New("set error"))
+			}),
+			call: func(s n26keychain.Storage) error {
+				return s.Set("foo", "bar")
+			},
+			expectedError: "set error",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.call(n26keychain.NewVersionedStorage(tc.mockStorage(t)))
+
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestVersionNotSupported(t *testing.T) {
+	t.Parallel()
+
+	s := n26keychain.NewNamespacedStorage(mock.NoMockStorage(t), "staging")
+
+	_, _, err := n26keychain.GetVersion(s, "foo")
+
+	assert.ErrorIs(t, err, n26keychain.ErrVersionNotSupported)
+
+	_, err = n26keychain.SetIfMatch(mock.NoMockStorage(t), "foo", "", "bar")
+
+	assert.ErrorIs(t, err, n26keychain.ErrVersionNotSupported)
+}
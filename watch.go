@@ -0,0 +1,157 @@
+package n26keychain
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// DefaultPollInterval is the interval between two reads of a watched entry.
+const DefaultPollInterval = 5 * time.Second
+
+// ErrNotifyNotSupported indicates that the storage does not notify about its changes.
+var ErrNotifyNotSupported = errors.New("storage does not support notifications")
+
+// Notifier is a storage that notifies about its changes, so a watched entry is read right away instead of at the next
+// poll.
+type Notifier interface {
+	// Notify returns a channel that receives a value when any entry may have changed. The channel is closed when the
+	// context is done.
+	Notify(ctx context.Context) (<-chan struct{}, error)
+}
+
+// WatchEvent is a change of a watched entry.
+type WatchEvent struct {
+	Key     string
+	Value   string
+	Deleted bool
+}
+
+// WatchOption configures Watch.
+type WatchOption func(w *watcher)
+
+type watchState struct {
+	known bool
+	found bool
+	hash  [sha256.Size]byte
+}
+
+type watcher struct {
+	storage StorageContext
+	key     string
+
+	interval time.Duration
+}
+
+func (w *watcher) run(ctx context.Context, state watchState, notify <-chan struct{}, events chan<- WatchEvent) {
+	defer close(events)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+
+		case _, ok := <-notify:
+			if !ok {
+				notify = nil
+			}
+		}
+
+		next, event := w.read(ctx)
+		if !next.known {
+			continue
+		}
+
+		changed := state.known && (next.found != state.found || next.hash != state.hash)
+		state = next
+
+		if !changed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case events <- event:
+		}
+	}
+}
+
+// read reads the entry and returns its state. Only the hash of the value is kept between two reads.
+func (w *watcher) read(ctx context.Context) (watchState, WatchEvent) {
+	event := WatchEvent{Key: w.key}
+
+	value, err := w.storage.GetContext(ctx, w.key)
+	if err != nil {
+		if !errors.Is(err, keyring.ErrNotFound) {
+			return watchState{}, event
+		}
+
+		event.Deleted = true
+
+		return watchState{known: true}, event
+	}
+
+	event.Value = value
+
+	return watchState{known: true, found: true, hash: sha256.Sum256([]byte(value))}, event
+}
+
+// Watch watches an entry and sends an event every time its value changes or it is deleted. The storage is read at
+// every poll interval, see WithPollInterval, and right away when the storage notifies about a change, see Notifier.
+// The read errors are ignored, the entry keeps its last known state until the storage can be read again. The channel
+// is closed when the context is done.
+func Watch(ctx context.Context, s Storage, key string, options ...WatchOption) <-chan WatchEvent {
+	w := &watcher{
+		storage:  ToStorageContext(s),
+		key:      key,
+		interval: DefaultPollInterval,
+	}
+
+	for _, o := range options {
+		o(w)
+	}
+
+	if w.interval <= 0 {
+		w.interval = DefaultPollInterval
+	}
+
+	// Without notifications, the storage is only polled.
+	notify, err := notifyChanges(ctx, s)
+	if err != nil {
+		notify = nil
+	}
+
+	state, _ := w.read(ctx)
+	events := make(chan WatchEvent)
+
+	go w.run(ctx, state, notify, events)
+
+	return events
+}
+
+// WithPollInterval sets the interval between two reads of the watched entry. DefaultPollInterval is used if the
+// interval is not positive.
+func WithPollInterval(interval time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.interval = interval
+	}
+}
+
+func notifyChanges(ctx context.Context, s interface{}) (<-chan struct{}, error) {
+	n, ok := s.(Notifier)
+	if !ok {
+		return nil, ErrNotifyNotSupported
+	}
+
+	return n.Notify(ctx)
+}
@@ -0,0 +1,186 @@
+package n26keychain_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/nhatthm/n26keychain"
+	"github.com/nhatthm/n26keychain/mock"
+)
+
+// pollOnly hides the notifications of the storage.
+type pollOnly struct {
+	n26keychain.Storage
+}
+
+func TestWatch_Notify(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := n26keychain.NewMemoryStorage()
+
+	require.NoError(t, s.Set("foo", "1"))
+
+	// The storage is not polled during the test.
+	events := n26keychain.Watch(ctx, s, "foo", n26keychain.WithPollInterval(time.Hour))
+
+	// Other keys and unchanged values do not send events.
+	require.NoError(t, s.Set("bar", "2"))
+	require.NoError(t, s.Set("foo", "1"))
+	require.NoError(t, s.Set("foo", "3"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "3"}, receiveEvent(t, events))
+
+	require.NoError(t, s.Delete("foo"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Deleted: true}, receiveEvent(t, events))
+
+	s.Restore(map[string]string{"foo": "4"})
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "4"}, receiveEvent(t, events))
+
+	// The channel is closed when the context is done.
+	cancel()
+
+	_, ok := <-events
+
+	assert.False(t, ok)
+}
+
+func TestWatch_Poll(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := n26keychain.NewMemoryStorage()
+	events := n26keychain.Watch(ctx, pollOnly{s}, "foo", n26keychain.WithPollInterval(time.Millisecond))
+
+	require.NoError(t, s.Set("foo", "1"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "1"}, receiveEvent(t, events))
+
+	require.NoError(t, s.Delete("foo"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Deleted: true}, receiveEvent(t, events))
+}
+
+func TestWatch_InvalidPollInterval(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := n26keychain.NewMemoryStorage()
+
+	// The default interval is used, the changes are still notified.
+	events := n26keychain.Watch(ctx, s, "foo", n26keychain.WithPollInterval(0))
+
+	require.NoError(t, s.Set("foo", "1"))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "1"}, receiveEvent(t, events))
+}
+
+func TestWatch_IgnoreErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := mock.MockStorage(func(s *mock.Storage) {
+		s.On("Get", "foo").Return("1", nil).Once()
+		s.On("Get", "foo").Return("", errors.New("get error")).Times(3)
+		s.On("Get", "foo").Return("", keyring.ErrUnsupportedPlatform).Once()
+		s.On("Get", "foo").Return("1", nil).Once()
+		s.On("Get", "foo").Return("2", nil)
+	})(t)
+
+	events := n26keychain.Watch(ctx, s, "foo", n26keychain.WithPollInterval(time.Millisecond))
+
+	assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "2"}, receiveEvent(t, events))
+}
+
+func receiveEvent(t *testing.T, events <-chan n26keychain.WatchEvent) n26keychain.WatchEvent {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		return e
+
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+
+	return n26keychain.WatchEvent{}
+}
+
+func TestWatch_NotifyDecorators(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		storage  func(t *testing.T) n26keychain.Storage
+	}{
+		{
+			scenario: "indexed",
+			storage: func(*testing.T) n26keychain.Storage {
+				return n26keychain.NewIndexedStorage(n26keychain.NewMemoryStorage())
+			},
+		},
+		{
+			scenario: "encrypted",
+			storage: func(*testing.T) n26keychain.Storage {
+				return n26keychain.NewEncryptedStorage(n26keychain.NewMemoryStorage(),
+					n26keychain.NewStaticKeyProvider("key1", masterKey1),
+				)
+			},
+		},
+		{
+			scenario: "chunked",
+			storage: func(*testing.T) n26keychain.Storage {
+				return n26keychain.NewChunkedStorage(n26keychain.NewMemoryStorage(), 4)
+			},
+		},
+		{
+			scenario: "file",
+			storage: func(t *testing.T) n26keychain.Storage {
+				t.Helper()
+
+				return newFileStorage(filepath.Join(t.TempDir(), "storage.json"), "secret")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := tc.storage(t)
+
+			// The storage is not polled during the test.
+			events := n26keychain.Watch(ctx, s, "foo", n26keychain.WithPollInterval(time.Hour))
+
+			require.NoError(t, s.Set("foo", "value"))
+
+			assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Value: "value"}, receiveEvent(t, events))
+
+			require.NoError(t, s.Delete("foo"))
+
+			assert.Equal(t, n26keychain.WatchEvent{Key: "foo", Deleted: true}, receiveEvent(t, events))
+		})
+	}
+}